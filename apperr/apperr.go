@@ -0,0 +1,164 @@
+// Package apperr defines the errors clients may see. Each one carries a code that is exposed in the
+// GraphQL error extensions and mapped to a gRPC or HTTP status, anything else is reported as an internal error
+// whose details are only logged.
+package apperr
+
+import (
+	"errors"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type Code string
+
+const (
+	Unauthenticated  Code = "UNAUTHENTICATED"
+	Forbidden        Code = "FORBIDDEN"
+	NotFound         Code = "NOT_FOUND"
+	ValidationFailed Code = "VALIDATION_FAILED"
+	Conflict         Code = "CONFLICT"
+	// FailedPrecondition rejects an action the current state of the record doesn't allow
+	FailedPrecondition Code = "FAILED_PRECONDITION"
+	// MethodNotAllowed rejects an HTTP method the resource doesn't support
+	MethodNotAllowed Code = "METHOD_NOT_ALLOWED"
+	Internal         Code = "INTERNAL"
+)
+
+var grpcCodes = map[Code]codes.Code{
+	Unauthenticated:    codes.Unauthenticated,
+	Forbidden:          codes.PermissionDenied,
+	NotFound:           codes.NotFound,
+	ValidationFailed:   codes.InvalidArgument,
+	Conflict:           codes.AlreadyExists,
+	FailedPrecondition: codes.FailedPrecondition,
+	MethodNotAllowed:   codes.Unimplemented,
+	Internal:           codes.Internal,
+}
+
+var httpStatuses = map[Code]int{
+	Unauthenticated:    http.StatusUnauthorized,
+	Forbidden:          http.StatusForbidden,
+	NotFound:           http.StatusNotFound,
+	ValidationFailed:   http.StatusBadRequest,
+	Conflict:           http.StatusConflict,
+	FailedPrecondition: http.StatusConflict,
+	MethodNotAllowed:   http.StatusMethodNotAllowed,
+	Internal:           http.StatusInternalServerError,
+}
+
+type Error struct {
+	Code    Code
+	Message string
+	// Fields explains per argument why validation failed
+	Fields map[string]string
+	// Err is the underlying cause, it's never shown to clients
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Extensions is picked up by graphql-go and rendered in the `extensions` of the error
+func (e *Error) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.Code}
+	if len(e.Fields) > 0 {
+		ext["fields"] = e.Fields
+	}
+	return ext
+}
+
+// GRPCStatus lets the gRPC server answer with the status matching the code
+func (e *Error) GRPCStatus() *status.Status {
+	code, ok := grpcCodes[e.Code]
+	if !ok {
+		code = codes.Unknown
+	}
+
+	message := e.Message
+	if len(e.Fields) > 0 {
+		names := make([]string, 0, len(e.Fields))
+		for name := range e.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var problems []string
+		for _, name := range names {
+			problems = append(problems, name+" "+e.Fields[name])
+		}
+		message += ": " + strings.Join(problems, ", ")
+	}
+
+	return status.New(code, message)
+}
+
+// HTTPStatus is the status of a plain HTTP response carrying the error
+func (e *Error) HTTPStatus() int {
+	status, ok := httpStatuses[e.Code]
+	if !ok {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap keeps err as the cause of an error with a client safe message
+func Wrap(code Code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// Validation reports the invalid arguments, fields maps each argument to the problem with it
+func Validation(fields map[string]string) *Error {
+	return &Error{Code: ValidationFailed, Message: "invalid input", Fields: fields}
+}
+
+// From converts any error to an *Error, unknown errors become internal ones
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "23":
+			if pqErr.Code.Name() == "unique_violation" {
+				return Wrap(Conflict, "a record with the same values already exists", err)
+			}
+			return Wrap(ValidationFailed, "the input violates a constraint", err)
+		case "22":
+			return Wrap(ValidationFailed, "the input has an invalid format", err)
+		}
+	}
+
+	return Wrap(Internal, "internal error", err)
+}
+
+// Format renders err like graphql-go renders resolver errors, with the code in the extensions
+func Format(err error) gqlerrors.FormattedError {
+	appErr := From(err)
+	return gqlerrors.FormatError(&gqlerrors.Error{
+		Message:       appErr.Message,
+		Locations:     []location.SourceLocation{},
+		OriginalError: appErr,
+	})
+}
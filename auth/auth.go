@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/logging"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/gloompi/tantora-back/app/utils"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleProducer Role = "producer"
+	RoleAudience Role = "audience"
+)
+
+// Scope is a permission granted to a long lived token, regular sessions aren't limited by scopes
+type Scope string
+
+const (
+	ScopeUsersRead        Scope = "users:read"
+	ScopeExhibitionsRead  Scope = "exhibitions:read"
+	ScopeExhibitionsWrite Scope = "exhibitions:write"
+	ScopeChatRead         Scope = "chat:read"
+	ScopeChatWrite        Scope = "chat:write"
+)
+
+// Scopes lists every scope a token may be granted
+var Scopes = []Scope{ScopeUsersRead, ScopeExhibitionsRead, ScopeExhibitionsWrite, ScopeChatRead, ScopeChatWrite}
+
+// ValidScope reports whether name is one of Scopes
+func ValidScope(name string) bool {
+	for _, scope := range Scopes {
+		if string(scope) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	ErrUnauthenticated = apperr.New(apperr.Unauthenticated, "unauthenticated")
+	ErrForbidden       = apperr.New(apperr.Forbidden, "you don't have permission to perform this action")
+	ErrMissingScope    = apperr.New(apperr.Forbidden, "the token doesn't grant the scope needed for this action")
+)
+
+// Identity describes the caller of a request
+type Identity struct {
+	UserId string
+	Roles  []Role
+	// Scopes limits a caller using a long lived token, nil for a regular session
+	Scopes []Scope
+	// SessionId is the login the access token belongs to, empty for tokens and keys outside of sessions
+	SessionId string
+}
+
+// HasAny reports whether the identity has at least one of the given roles
+func (i *Identity) HasAny(roles ...Role) bool {
+	for _, have := range i.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Allows reports whether the identity may do what scope guards, an empty scope is reserved to regular sessions
+func (i *Identity) Allows(scope Scope) bool {
+	if i.Scopes == nil {
+		return true
+	}
+
+	for _, have := range i.Scopes {
+		if scope != "" && have == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type contextKey struct{}
+
+type state struct {
+	identity *Identity
+	err      error
+}
+
+// NewContext stores the outcome of authentication, err explains why identity is missing.
+// The request logger is tagged with the user id of an authenticated caller
+func NewContext(ctx context.Context, identity *Identity, err error) context.Context {
+	if identity != nil {
+		ctx = logging.WithFields(ctx, logrus.Fields{"user_id": identity.UserId})
+	}
+
+	return context.WithValue(ctx, contextKey{}, state{identity, err})
+}
+
+// FromContext returns the caller identity or the reason there isn't one
+func FromContext(ctx context.Context) (*Identity, error) {
+	s, ok := ctx.Value(contextKey{}).(state)
+	if !ok || (s.identity == nil && s.err == nil) {
+		return nil, ErrUnauthenticated
+	}
+
+	if s.identity == nil {
+		return nil, s.err
+	}
+
+	return s.identity, nil
+}
+
+// Load builds the identity of a user from the roles stored in the database
+func Load(ctx context.Context, roles store.RoleStore, userId string) (*Identity, error) {
+	names, err := roles.Of(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{UserId: userId}
+
+	for _, name := range names {
+		identity.Roles = append(identity.Roles, Role(name))
+	}
+
+	if len(identity.Roles) == 0 {
+		identity.Roles = []Role{RoleAudience}
+	}
+
+	return identity, nil
+}
+
+// Authenticate validates the bearer token of the request and loads the caller roles
+func Authenticate(req *http.Request, s *store.Store) (*Identity, error) {
+	return AuthenticateToken(req.Context(), utils.ExtractToken(req), s)
+}
+
+// AuthenticateToken validates a raw access token or API key and loads the caller roles
+func AuthenticateToken(ctx context.Context, token string, s *store.Store) (*Identity, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	if strings.HasPrefix(token, utils.APIKeyPrefix) {
+		return authenticateKey(ctx, token, s)
+	}
+
+	details, err := utils.ValidateToken(token)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Unauthenticated, "the token is invalid, expired or revoked", err)
+	}
+
+	identity, err := Load(ctx, s.Roles, details.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	identity.SessionId = details.SessionId
+	if details.Scopes != nil {
+		identity.Scopes = scopes(details.Scopes)
+	}
+
+	return identity, nil
+}
+
+func authenticateKey(ctx context.Context, token string, s *store.Store) (*Identity, error) {
+	key, err := s.APIKeys.ByHash(ctx, utils.HashAPIKey(token))
+	if err == store.ErrNotFound {
+		return nil, apperr.Wrap(apperr.Unauthenticated, "the API key is invalid or revoked", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// a failed bookkeeping write shouldn't turn the key down
+	if err := s.APIKeys.Touch(ctx, key.KeyId); err != nil {
+		logging.FromContext(ctx).WithError(err).Warn("Failed to record API key use")
+	}
+
+	identity, err := Load(ctx, s.Roles, key.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	identity.Scopes = scopes(key.Scopes)
+
+	return identity, nil
+}
+
+// Convert stored scope names, the result is never nil so an empty list grants nothing
+func scopes(names []string) []Scope {
+	list := []Scope{}
+	for _, name := range names {
+		list = append(list, Scope(name))
+	}
+	return list
+}
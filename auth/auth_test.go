@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/gloompi/tantora-back/app/store/storetest"
+	"github.com/gloompi/tantora-back/app/utils"
+	"testing"
+)
+
+// Store a new key of the user and return it in clear
+func createKey(t *testing.T, fakes *storetest.Fakes, userId string, scopes ...string) (string, *store.APIKey) {
+	t.Helper()
+
+	key, prefix, _, err := utils.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hashed here rather than with utils.HashAPIKey so a change of the lookup hash is noticed
+	sum := sha256.Sum256([]byte(key))
+
+	apiKey, err := fakes.APIKeys.Create(context.Background(), store.NewAPIKey{
+		UserId: userId,
+		Name:   "integration",
+		Prefix: prefix,
+		Hash:   hex.EncodeToString(sum[:]),
+		Scopes: scopes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, apiKey
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	fakes := storetest.New()
+	fakes.AddUser("2", "producer")
+
+	key, apiKey := createKey(t, fakes, "2", string(ScopeChatRead))
+
+	identity, err := AuthenticateToken(context.Background(), key, fakes.Store())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.UserId != "2" || !identity.HasAny(RoleProducer) || identity.SessionId != "" {
+		t.Fatalf("got identity %+v", identity)
+	}
+
+	if len(identity.Scopes) != 1 || identity.Scopes[0] != ScopeChatRead {
+		t.Fatalf("got scopes %v, want the scopes of the key", identity.Scopes)
+	}
+
+	keys, _ := fakes.APIKeys.Of(context.Background(), "2")
+	if len(keys) != 1 || keys[0].KeyId != apiKey.KeyId || keys[0].LastUsedAt == nil {
+		t.Fatal("the use of the key wasn't recorded")
+	}
+}
+
+func TestAuthenticateRejectsUnknownAndRevokedKeys(t *testing.T) {
+	fakes := storetest.New()
+	fakes.AddUser("2")
+
+	key, apiKey := createKey(t, fakes, "2", string(ScopeChatRead))
+
+	unknown, _, _, err := utils.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AuthenticateToken(context.Background(), unknown, fakes.Store()); apperr.From(err).Code != apperr.Unauthenticated {
+		t.Fatalf("an unknown key got %v", err)
+	}
+
+	if err := fakes.APIKeys.Revoke(context.Background(), "2", apiKey.KeyId); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AuthenticateToken(context.Background(), key, fakes.Store()); apperr.From(err).Code != apperr.Unauthenticated {
+		t.Fatalf("a revoked key got %v", err)
+	}
+}
+
+func TestAllows(t *testing.T) {
+	session := &Identity{UserId: "1"}
+	scoped := &Identity{UserId: "1", Scopes: []Scope{ScopeChatRead}}
+	everything := &Identity{UserId: "1", Scopes: Scopes}
+	nothing := &Identity{UserId: "1", Scopes: []Scope{}}
+
+	tests := []struct {
+		name     string
+		identity *Identity
+		scope    Scope
+		allowed  bool
+	}{
+		{"session, scoped action", session, ScopeChatWrite, true},
+		{"session, action reserved to sessions", session, "", true},
+		{"granted scope", scoped, ScopeChatRead, true},
+		{"missing scope", scoped, ScopeChatWrite, false},
+		{"every scope, action reserved to sessions", everything, "", false},
+		{"no scopes", nothing, ScopeChatRead, false},
+	}
+
+	for _, test := range tests {
+		if allowed := test.identity.Allows(test.scope); allowed != test.allowed {
+			t.Errorf("%s: got %v, want %v", test.name, allowed, test.allowed)
+		}
+	}
+}
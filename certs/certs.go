@@ -0,0 +1,189 @@
+// Package certs keeps the TLS certificates of the servers up to date with the files on disk so they
+// can be rotated without a restart.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/gloompi/tantora-back/app/config"
+	"github.com/gloompi/tantora-back/app/logging"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader serves the latest certificate and client CAs loaded from the configured files
+type Reloader struct {
+	conf config.TLS
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modified  time.Time
+}
+
+// New loads the files once, failing if any of them is missing or invalid
+func New(conf config.TLS) (*Reloader, error) {
+	r := &Reloader{conf: conf}
+
+	modified, err := r.lastModified()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.load(modified); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.conf.CertFile, r.conf.KeyFile}
+	if r.conf.ClientCAFile != "" {
+		files = append(files, r.conf.ClientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) lastModified() (time.Time, error) {
+	var latest time.Time
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+func (r *Reloader) load(modified time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+	if err != nil {
+		return fmt.Errorf("could not load key pair %s, %s: %v", r.conf.CertFile, r.conf.KeyFile, err)
+	}
+
+	var clientCAs *x509.CertPool
+
+	if r.conf.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.conf.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.conf.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modified = modified
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Watch polls the files every interval and reloads them once they change, it blocks until ctx is done.
+// A broken update is logged and the previous certificate is kept
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modified, err := r.lastModified()
+		if err != nil {
+			logging.Logger().WithError(err).WithField("file", r.conf.CertFile).Error("Failed to check certificate")
+			continue
+		}
+
+		r.mu.RLock()
+		changed := !modified.Equal(r.modified)
+		r.mu.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		if err := r.load(modified); err != nil {
+			logging.Logger().WithError(err).Error("Keeping the previous certificate, reload failed")
+			continue
+		}
+
+		logging.Logger().WithField("file", r.conf.CertFile).Info("Reloaded certificate")
+	}
+}
+
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// The pool given to tls.Config is fixed, so client certificates are checked against the current one here
+func (r *Reloader) verifyClient(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("client certificate required")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	r.mu.RLock()
+	roots := r.clientCAs
+	r.mu.RUnlock()
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	return err
+}
+
+// TLSConfig returns a server configuration that always presents the latest certificate and requires
+// client certificates when a client CA file is configured
+func (r *Reloader) TLSConfig() *tls.Config {
+	c := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+
+	if r.conf.ClientCAFile != "" {
+		c.ClientAuth = tls.RequireAnyClientCert
+		c.VerifyPeerCertificate = r.verifyClient
+	}
+
+	return c
+}
@@ -0,0 +1,214 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/gloompi/tantora-back/app/config"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type issued struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// Issue a certificate signed by parent, a self-signed one when parent is nil
+func issue(t *testing.T, serial int64, parent *issued, isCA bool, usage x509.ExtKeyUsage) *issued {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "test"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &issued{cert, key, der}
+}
+
+func (i *issued) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{i.der}, PrivateKey: i.key}
+}
+
+func writeFiles(t *testing.T, dir string, leaf, ca *issued) config.TLS {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(leaf.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := config.TLS{
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+	}
+
+	write := func(file, kind string, der []byte) {
+		if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(conf.CertFile, "CERTIFICATE", leaf.der)
+	write(conf.KeyFile, "EC PRIVATE KEY", keyDER)
+
+	if ca != nil {
+		conf.ClientCAFile = filepath.Join(dir, "ca.crt")
+		write(conf.ClientCAFile, "CERTIFICATE", ca.der)
+	}
+
+	return conf
+}
+
+func TestWatchReloadsRewrittenFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := issue(t, 1, nil, true, 0)
+	conf := writeFiles(t, dir, issue(t, 10, ca, false, x509.ExtKeyUsageServerAuth), nil)
+
+	r, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	writeFiles(t, dir, issue(t, 20, ca, false, x509.ExtKeyUsageServerAuth), nil)
+
+	// coarse file systems may keep the modification time, move it forward explicitly
+	future := time.Now().Add(time.Minute)
+	for _, file := range []string{conf.CertFile, conf.KeyFile} {
+		if err := os.Chtimes(file, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cert, _ := r.getCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if leaf.SerialNumber.Int64() == 20 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("still serving serial %d after the files were rewritten", leaf.SerialNumber.Int64())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Run a handshake between the reloader configuration and a client presenting cert
+func handshake(t *testing.T, r *Reloader, ca *issued, cert *tls.Certificate) error {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	clientConf := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+	if cert != nil {
+		clientConf.Certificates = []tls.Certificate{*cert}
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		server := tls.Server(serverConn, r.TLSConfig())
+		err := server.Handshake()
+		serverErr <- err
+		// unblock the client when the server rejected it
+		server.Close()
+	}()
+
+	client := tls.Client(clientConn, clientConf)
+	client.Handshake()
+	// TLS 1.3 clients only learn about a rejected certificate on the first read
+	client.Read(make([]byte, 1))
+
+	return <-serverErr
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := issue(t, 1, nil, true, 0)
+	conf := writeFiles(t, dir, issue(t, 10, ca, false, x509.ExtKeyUsageServerAuth), ca)
+
+	r, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := issue(t, 30, ca, false, x509.ExtKeyUsageClientAuth).tlsCertificate()
+	if err := handshake(t, r, ca, &signed); err != nil {
+		t.Fatalf("a client signed by the CA was rejected: %v", err)
+	}
+
+	unsigned := issue(t, 40, nil, false, x509.ExtKeyUsageClientAuth).tlsCertificate()
+	if err := handshake(t, r, ca, &unsigned); err == nil {
+		t.Fatal("a client not signed by the CA was accepted")
+	}
+
+	if err := handshake(t, r, ca, nil); err == nil {
+		t.Fatal("a client without a certificate was accepted")
+	}
+}
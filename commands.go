@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gloompi/tantora-back/app/migrations"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// Run a subcommand given on the command line instead of the servers
+func runCommand(args []string) error {
+	switch args[0] {
+	case "migrate":
+		openDatabase()
+		return runMigrate(args[1:])
+	case "config":
+		return runConfig(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, available commands: migrate, config", args[0])
+	}
+}
+
+func runConfig(args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New("usage: config print")
+	}
+
+	out, err := conf.Redacted().YAML()
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(out)
+
+	if err := conf.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	return nil
+}
+
+func runMigrate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: migrate up|down|status")
+	}
+
+	switch args[0] {
+	case "up":
+		ran, err := migrations.Up(db)
+		for _, m := range ran {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(ran) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		return err
+	case "down":
+		m, err := migrations.Down(db)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			fmt.Println("Nothing to roll back")
+			return nil
+		}
+		fmt.Printf("Rolled back %04d_%s\n", m.Version, m.Name)
+		return nil
+	case "status":
+		statuses, err := migrations.Statuses(db)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate action %q, use up, down or status", args[0])
+	}
+}
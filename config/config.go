@@ -0,0 +1,343 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// TLS is enabled once a certificate is configured, a client CA additionally requires client certificates
+type TLS struct {
+	CertFile     string `yaml:"certFile"`
+	KeyFile      string `yaml:"keyFile"`
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+type HTTP struct {
+	Port int `yaml:"port"`
+	TLS  TLS `yaml:"tls"`
+	// TrustedProxies are the IPs or CIDR ranges of the proxies whose X-Forwarded-For header is believed
+	TrustedProxies []string `yaml:"trustedProxies"`
+}
+
+// TrustedNetworks parses TrustedProxies, single IPs become networks of one address
+func (h HTTP) TrustedNetworks() ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+
+	for _, proxy := range h.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is neither an IP nor a CIDR range", proxy)
+		}
+
+		bits := 8 * len(ip)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+
+	return networks, nil
+}
+
+type GRPC struct {
+	Port int `yaml:"port"`
+	TLS  TLS `yaml:"tls"`
+}
+
+type Postgres struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Address  string `yaml:"address"`
+	Database string `yaml:"database"`
+	SSLMode  string `yaml:"sslMode"`
+}
+
+// URL returns the connection string understood by lib/pq
+func (p Postgres) URL() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(p.Username, p.Password),
+		Host:     p.Address,
+		Path:     "/" + p.Database,
+		RawQuery: url.Values{"sslmode": {p.SSLMode}}.Encode(),
+	}
+
+	return u.String()
+}
+
+type Redis struct {
+	Address  string `yaml:"address"`
+	Password string `yaml:"password"`
+}
+
+// JWT signs access tokens with the private key in SigningKeyFile when set, falling back to HS256 with
+// AccessSecret. The secret may be kept during the switch so tokens it signed keep verifying
+type JWT struct {
+	AccessSecret  string `yaml:"accessSecret"`
+	RefreshSecret string `yaml:"refreshSecret"`
+	// SigningKeyFile is a PEM RSA or Ed25519 private key
+	SigningKeyFile string `yaml:"signingKeyFile"`
+	// VerificationKeyFiles are PEM public keys of retired signing keys, kept until their tokens expire
+	VerificationKeyFiles []string `yaml:"verificationKeyFiles"`
+}
+
+// Tracing selects where spans are exported, see the tracing package for the available exporters
+type Tracing struct {
+	Exporter string `yaml:"exporter"`
+	// File is where the debug-file exporter writes
+	File        string `yaml:"file"`
+	ServiceName string `yaml:"serviceName"`
+}
+
+type Log struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type Config struct {
+	HTTP     HTTP     `yaml:"http"`
+	GRPC     GRPC     `yaml:"grpc"`
+	Postgres Postgres `yaml:"postgres"`
+	Redis    Redis    `yaml:"redis"`
+	JWT      JWT      `yaml:"jwt"`
+	Tracing  Tracing  `yaml:"tracing"`
+	Log      Log      `yaml:"log"`
+
+	// ShutdownTimeout bounds how long the servers may drain on exit
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+func defaults() *Config {
+	return &Config{
+		HTTP: HTTP{Port: 9999},
+		GRPC: GRPC{Port: 50051},
+		Postgres: Postgres{
+			Address:  "localhost:5432",
+			Database: "streaming_service",
+			SSLMode:  "disable",
+		},
+		Redis:           Redis{Address: "0.0.0.0:6379"},
+		Tracing:         Tracing{Exporter: "none", ServiceName: "tantora-back"},
+		Log:             Log{Level: "info", Format: "json"},
+		ShutdownTimeout: 15 * time.Second,
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file named by CONFIG_FILE and then
+// environment variables, each source overriding the previous one
+func Load() (*Config, error) {
+	conf := defaults()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config file: %v", err)
+		}
+
+		if err := yaml.UnmarshalStrict(content, conf); err != nil {
+			return nil, fmt.Errorf("could not parse config file %s: %v", path, err)
+		}
+	}
+
+	if err := conf.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+func (c *Config) applyEnv() error {
+	strs := map[string]*string{
+		"PSQL_USERNAME":  &c.Postgres.Username,
+		"PSQL_PASSWORD":  &c.Postgres.Password,
+		"PSQL_ADDRESS":   &c.Postgres.Address,
+		"PSQL_DB":        &c.Postgres.Database,
+		"PSQL_SSL_MODE":  &c.Postgres.SSLMode,
+		"REDIS_ADDRESS":  &c.Redis.Address,
+		"REDIS_PASSWORD": &c.Redis.Password,
+		"ACCESS_SECRET":  &c.JWT.AccessSecret,
+		"REFRESH_SECRET": &c.JWT.RefreshSecret,
+
+		"JWT_SIGNING_KEY_FILE": &c.JWT.SigningKeyFile,
+
+		"HTTP_TLS_CERT_FILE":      &c.HTTP.TLS.CertFile,
+		"HTTP_TLS_KEY_FILE":       &c.HTTP.TLS.KeyFile,
+		"HTTP_TLS_CLIENT_CA_FILE": &c.HTTP.TLS.ClientCAFile,
+		"GRPC_TLS_CERT_FILE":      &c.GRPC.TLS.CertFile,
+		"GRPC_TLS_KEY_FILE":       &c.GRPC.TLS.KeyFile,
+		"GRPC_TLS_CLIENT_CA_FILE": &c.GRPC.TLS.ClientCAFile,
+
+		"TRACING_EXPORTER":     &c.Tracing.Exporter,
+		"TRACING_FILE":         &c.Tracing.File,
+		"TRACING_SERVICE_NAME": &c.Tracing.ServiceName,
+
+		"LOG_LEVEL":  &c.Log.Level,
+		"LOG_FORMAT": &c.Log.Format,
+	}
+
+	ints := map[string]*int{
+		"PORT":      &c.HTTP.Port,
+		"GRPC_PORT": &c.GRPC.Port,
+	}
+
+	for name, field := range strs {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			*field = value
+		}
+	}
+
+	for name, field := range ints {
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("could not parse %s=%s to int", name, value)
+		}
+
+		*field = parsed
+	}
+
+	if value, ok := os.LookupEnv("JWT_VERIFICATION_KEY_FILES"); ok && value != "" {
+		c.JWT.VerificationKeyFiles = strings.Split(value, ",")
+	}
+
+	if value, ok := os.LookupEnv("HTTP_TRUSTED_PROXIES"); ok && value != "" {
+		c.HTTP.TrustedProxies = strings.Split(value, ",")
+	}
+
+	if value, ok := os.LookupEnv("SHUTDOWN_TIMEOUT"); ok && value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("could not parse SHUTDOWN_TIMEOUT=%s to duration", value)
+		}
+
+		c.ShutdownTimeout = parsed
+	}
+
+	return nil
+}
+
+// Validate reports every setting the servers can't start with
+func (c *Config) Validate() error {
+	var problems []string
+
+	for name, port := range map[string]int{"http.port": c.HTTP.Port, "grpc.port": c.GRPC.Port} {
+		if port < 1 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("%s must be between 1 and 65535", name))
+		}
+	}
+
+	if c.HTTP.Port == c.GRPC.Port {
+		problems = append(problems, "http.port and grpc.port must differ")
+	}
+
+	for name, t := range map[string]TLS{"http.tls": c.HTTP.TLS, "grpc.tls": c.GRPC.TLS} {
+		if t.Enabled() && (t.CertFile == "" || t.KeyFile == "") {
+			problems = append(problems, name+".certFile and "+name+".keyFile must be set together")
+		}
+
+		if !t.Enabled() && t.ClientCAFile != "" {
+			problems = append(problems, name+".clientCAFile requires a certificate")
+		}
+	}
+
+	if _, err := c.HTTP.TrustedNetworks(); err != nil {
+		problems = append(problems, "http.trustedProxies: "+err.Error())
+	}
+
+	if c.JWT.SigningKeyFile == "" && c.JWT.AccessSecret == "" {
+		problems = append(problems, "jwt.accessSecret or jwt.signingKeyFile must be set")
+	}
+
+	if c.JWT.SigningKeyFile == "" && len(c.JWT.VerificationKeyFiles) > 0 {
+		problems = append(problems, "jwt.verificationKeyFiles requires jwt.signingKeyFile")
+	}
+
+	if c.Tracing.Exporter == "debug-file" && c.Tracing.File == "" {
+		problems = append(problems, "tracing.file must be set for the debug-file exporter")
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, "log.level must be one of debug, info, warn, error")
+	}
+
+	if c.Log.Format != "json" && c.Log.Format != "logfmt" {
+		problems = append(problems, "log.format must be json or logfmt")
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, "shutdownTimeout must be positive")
+	}
+
+	required := map[string]string{
+		"postgres.address":  c.Postgres.Address,
+		"postgres.database": c.Postgres.Database,
+		"redis.address":     c.Redis.Address,
+		"jwt.refreshSecret": c.JWT.RefreshSecret,
+	}
+
+	for name, value := range required {
+		if value == "" {
+			problems = append(problems, name+" must be set")
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	sort.Strings(problems)
+	return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+}
+
+// Redacted returns a copy of the configuration that is safe to print
+func (c *Config) Redacted() *Config {
+	copied := *c
+
+	for _, secret := range []*string{
+		&copied.Postgres.Password,
+		&copied.Redis.Password,
+		&copied.JWT.AccessSecret,
+		&copied.JWT.RefreshSecret,
+	} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+
+	return &copied
+}
+
+// YAML renders the configuration in the format accepted by CONFIG_FILE
+func (c *Config) YAML() (string, error) {
+	out, err := yaml.Marshal(c)
+	return string(out), err
+}
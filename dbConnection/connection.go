@@ -2,10 +2,10 @@ package dbConnection
 
 import (
 	"database/sql"
-	"fmt"
+	"github.com/gloompi/tantora-back/app/config"
+	"github.com/gloompi/tantora-back/app/logging"
 	_ "github.com/lib/pq"
-	"log"
-	"os"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type connection struct {
@@ -14,28 +14,14 @@ type connection struct {
 
 var connectionInstance *connection
 
-func ReadConnection() *connection {
-	psqlUser := os.Getenv("PSQL_USERNAME")
-	psqlPassword := os.Getenv("PSQL_PASSWORD")
-	psqlAddress := os.Getenv("PSQL_ADDRESS")
-	psqlDb := os.Getenv("PSQL_DB")
-
-	if psqlAddress == "" {
-		psqlAddress = "localhost:5432"
-	}
-
-	if psqlDb == "" {
-		psqlDb = "streaming_service"
-	}
-
-	connStr := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", psqlUser, psqlPassword, psqlAddress, psqlDb)
-
+func ReadConnection(conf config.Postgres) *connection {
 	if connectionInstance == nil {
-		db, err := sql.Open("postgres", connStr)
+		db, err := sql.Open("postgres", conf.URL())
 
 		if err != nil {
-			log.Fatalln(err)
+			logging.Logger().WithError(err).Fatal("Failed to open database")
 		}
+		prometheus.MustRegister(newStatsCollector(db))
 		connectionInstance = &connection{db}
 	}
 
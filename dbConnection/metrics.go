@@ -0,0 +1,62 @@
+package dbConnection
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Expose the pool statistics of sql.DB, read on every scrape
+type statsCollector struct {
+	db *sql.DB
+
+	maxOpen       *prometheus.Desc
+	open          *prometheus.Desc
+	inUse         *prometheus.Desc
+	idle          *prometheus.Desc
+	waitCount     *prometheus.Desc
+	waitDuration  *prometheus.Desc
+	maxIdleClose  *prometheus.Desc
+	lifetimeClose *prometheus.Desc
+}
+
+func newStatsCollector(db *sql.DB) *statsCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("db_"+name, help, nil, nil)
+	}
+
+	return &statsCollector{
+		db:            db,
+		maxOpen:       desc("max_open_connections", "Maximum number of open connections to the database."),
+		open:          desc("open_connections", "The number of established connections both in use and idle."),
+		inUse:         desc("in_use_connections", "The number of connections currently in use."),
+		idle:          desc("idle_connections", "The number of idle connections."),
+		waitCount:     desc("wait_count_total", "The total number of connections waited for."),
+		waitDuration:  desc("wait_duration_seconds_total", "The total time blocked waiting for a new connection."),
+		maxIdleClose:  desc("max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns."),
+		lifetimeClose: desc("max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime."),
+	}
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClose
+	ch <- c.lifetimeClose
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClose, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.lifetimeClose, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gloompi/tantora-back/app/logging"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/gloompi/tantora-back/app/utils"
+)
+
+// Events go through redis pub/sub so every server instance sees them
+const (
+	messageChannelPrefix        = "chat:messages:"
+	exhibitionCreatedChannel    = "exhibitions:created"
+	exhibitionStartedChannel    = "exhibitions:started"
+	exhibitionStartedLockPrefix = "exhibitions:started:"
+)
+
+var ErrClosed = errors.New("event subscription was closed")
+
+func publish(channel string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return utils.Publish(channel, payload)
+}
+
+// Call handle with every payload published on the channel until ctx is done or handle fails
+func listen(ctx context.Context, channel string, handle func(payload []byte) error) error {
+	ps := utils.Subscribe(channel)
+	defer ps.Close()
+
+	// wait for redis to confirm the subscription so no event is missed
+	if _, err := ps.Receive(); err != nil {
+		return err
+	}
+
+	ch := ps.Channel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return ErrClosed
+			}
+
+			if err := handle([]byte(msg.Payload)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// PublishMessage notifies the receiver of a saved message
+func PublishMessage(m *store.Message) error {
+	return publish(messageChannelPrefix+m.ReceiverId, m)
+}
+
+// SubscribeMessages calls handle for every message sent to the user, it blocks until ctx is done
+func SubscribeMessages(ctx context.Context, userId string, handle func(*store.Message) error) error {
+	return listen(ctx, messageChannelPrefix+userId, func(payload []byte) error {
+		var m store.Message
+		if err := json.Unmarshal(payload, &m); err != nil {
+			logging.FromContext(ctx).WithError(err).Warn("Dropping malformed message event")
+			return nil
+		}
+
+		return handle(&m)
+	})
+}
+
+func subscribeExhibitions(ctx context.Context, channel string, handle func(*store.Exhibition) error) error {
+	return listen(ctx, channel, func(payload []byte) error {
+		var e store.Exhibition
+		if err := json.Unmarshal(payload, &e); err != nil {
+			logging.FromContext(ctx).WithError(err).Warn("Dropping malformed exhibition event")
+			return nil
+		}
+
+		return handle(&e)
+	})
+}
+
+func PublishExhibitionCreated(e *store.Exhibition) error {
+	return publish(exhibitionCreatedChannel, e)
+}
+
+// SubscribeExhibitionCreated calls handle for every new exhibition, it blocks until ctx is done
+func SubscribeExhibitionCreated(ctx context.Context, handle func(*store.Exhibition) error) error {
+	return subscribeExhibitions(ctx, exhibitionCreatedChannel, handle)
+}
+
+// SubscribeExhibitionStarted calls handle for every exhibition reaching its start date, it blocks until ctx is done
+func SubscribeExhibitionStarted(ctx context.Context, handle func(*store.Exhibition) error) error {
+	return subscribeExhibitions(ctx, exhibitionStartedChannel, handle)
+}
@@ -0,0 +1,47 @@
+package events
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/logging"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/gloompi/tantora-back/app/utils"
+	"time"
+)
+
+// WatchExhibitionStarts publishes an event for every exhibition whose start date has passed.
+// Every instance runs the watcher, a redis lock makes sure each exhibition is announced once.
+func WatchExhibitionStarts(ctx context.Context, exhibitions store.ExhibitionStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// look back two intervals so a slow tick doesn't skip anything
+		started, err := exhibitions.StartedWithin(ctx, 2*interval)
+		if err != nil {
+			logging.FromContext(ctx).WithError(err).Error("Failed to look up started exhibitions")
+			continue
+		}
+
+		for _, e := range started {
+			first, err := utils.SetNX(exhibitionStartedLockPrefix+e.ExhibitionId, 1, 4*interval)
+			if err != nil {
+				logging.FromContext(ctx).WithError(err).WithField("exhibition_id", e.ExhibitionId).Error("Failed to lock exhibition")
+				continue
+			}
+
+			if !first {
+				continue
+			}
+
+			if err := publish(exhibitionStartedChannel, e); err != nil {
+				logging.FromContext(ctx).WithError(err).WithField("exhibition_id", e.ExhibitionId).Error("Failed to publish exhibition start")
+			}
+		}
+	}
+}
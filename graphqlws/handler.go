@@ -0,0 +1,329 @@
+// Package graphqlws serves GraphQL subscriptions over websocket using the graphql-ws protocol
+// of subscriptions-transport-ws.
+package graphqlws
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/logging"
+	"github.com/gloompi/tantora-back/app/schema"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/gloompi/tantora-back/app/utils"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	protocol = "graphql-ws"
+
+	gqlConnectionInit      = "connection_init"
+	gqlConnectionAck       = "connection_ack"
+	gqlConnectionError     = "connection_error"
+	gqlConnectionKeepAlive = "ka"
+	gqlConnectionTerminate = "connection_terminate"
+	gqlStart               = "start"
+	gqlStop                = "stop"
+	gqlData                = "data"
+	gqlError               = "error"
+	gqlComplete            = "complete"
+
+	keepAliveInterval = 15 * time.Second
+	writeTimeout      = 10 * time.Second
+	maxMessageSize    = 64 * 1024
+)
+
+type operationMessage struct {
+	Id      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type startPayload struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{protocol},
+	// same policy as the CORS headers on /graphql
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// NewHandler serves websocket upgrades with subscriptions and passes any other request to next,
+// open connections are closed once closing is. It expects the request context built by the request
+// middleware, subscriptions inherit its request id, trace and the identity of the upgrade request
+func NewHandler(s graphql.Schema, stores *store.Store, closing <-chan struct{}, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !websocket.IsWebSocketUpgrade(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		ws, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+
+		defer ws.Close()
+
+		if ws.Subprotocol() != protocol {
+			ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseProtocolError, "expected the graphql-ws subprotocol"),
+				time.Now().Add(writeTimeout))
+			return
+		}
+
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+
+		ctx = logging.WithFields(ctx, logrus.Fields{"protocol": protocol})
+
+		// hijacked connections are not tracked by http.Server.Shutdown
+		go func() {
+			select {
+			case <-closing:
+				ws.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"),
+					time.Now().Add(writeTimeout))
+				ws.Close()
+			case <-ctx.Done():
+			}
+		}()
+
+		c := &connection{
+			ws:         ws,
+			req:        req,
+			schema:     s,
+			stores:     stores,
+			ctx:        ctx,
+			operations: map[string]context.CancelFunc{},
+		}
+		c.serve()
+	})
+}
+
+type connection struct {
+	ws     *websocket.Conn
+	req    *http.Request
+	schema graphql.Schema
+	stores *store.Store
+
+	// ctx carries the caller identity once the connection is initialised
+	ctx         context.Context
+	initialized bool
+
+	writeMu sync.Mutex
+
+	mu         sync.Mutex
+	operations map[string]context.CancelFunc
+}
+
+func (c *connection) write(msg operationMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.ws.WriteJSON(msg)
+}
+
+func (c *connection) send(id, messageType string, payload interface{}) error {
+	msg := operationMessage{Id: id, Type: messageType}
+
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		msg.Payload = raw
+	}
+
+	return c.write(msg)
+}
+
+func (c *connection) sendError(id string, err error) {
+	var payload interface{} = apperr.Format(err)
+	if reqErr, ok := err.(*schema.RequestError); ok {
+		payload = reqErr.Errors
+	}
+
+	c.send(id, gqlError, payload)
+}
+
+func (c *connection) serve() {
+	c.ws.SetReadLimit(maxMessageSize)
+
+	defer c.stopAll()
+
+	for {
+		var msg operationMessage
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		switch msg.Type {
+		case gqlConnectionInit:
+			if err := c.init(msg.Payload); err != nil {
+				c.send("", gqlConnectionError, apperr.Format(err))
+				return
+			}
+		case gqlStart:
+			c.start(msg.Id, msg.Payload)
+		case gqlStop:
+			c.stop(msg.Id)
+		case gqlConnectionTerminate:
+			return
+		default:
+			c.send(msg.Id, gqlError, map[string]string{"message": "unknown message type " + msg.Type})
+		}
+	}
+}
+
+// Read the bearer token from the init payload, falling back to the upgrade request headers
+func (c *connection) token(payload json.RawMessage) string {
+	var params map[string]interface{}
+	json.Unmarshal(payload, &params)
+
+	for key, value := range params {
+		switch strings.ToLower(key) {
+		case "authorization", "authtoken", "token":
+			token, _ := value.(string)
+			if strArr := strings.Split(token, " "); len(strArr) == 2 {
+				return strArr[1]
+			}
+			return token
+		}
+	}
+
+	return utils.ExtractToken(c.req)
+}
+
+func (c *connection) init(payload json.RawMessage) error {
+	if c.initialized {
+		return nil
+	}
+
+	if token := c.token(payload); token != "" {
+		identity, err := auth.AuthenticateToken(c.ctx, token, c.stores)
+		if err != nil {
+			return err
+		}
+
+		c.ctx = auth.NewContext(c.ctx, identity, nil)
+	}
+
+	c.initialized = true
+
+	if err := c.send("", gqlConnectionAck, nil); err != nil {
+		return err
+	}
+
+	go c.keepAlive()
+
+	return nil
+}
+
+func (c *connection) keepAlive() {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.send("", gqlConnectionKeepAlive, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *connection) start(id string, payload json.RawMessage) {
+	if !c.initialized {
+		c.sendError(id, auth.ErrUnauthenticated)
+		return
+	}
+
+	var params startPayload
+	if err := json.Unmarshal(payload, &params); err != nil {
+		c.sendError(id, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+
+	c.mu.Lock()
+	if _, exists := c.operations[id]; exists {
+		c.mu.Unlock()
+		cancel()
+		c.send(id, gqlError, map[string]string{"message": "an operation with id " + id + " is already running"})
+		return
+	}
+	c.operations[id] = cancel
+	c.mu.Unlock()
+
+	go func() {
+		err := schema.Subscribe(ctx, graphql.Params{
+			Schema:         c.schema,
+			RequestString:  params.Query,
+			VariableValues: params.Variables,
+			OperationName:  params.OperationName,
+		}, func(result *graphql.Result) error {
+			return c.send(id, gqlData, result)
+		})
+
+		// a stopped operation or closed connection doesn't need an answer
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.mu.Lock()
+		delete(c.operations, id)
+		c.mu.Unlock()
+		cancel()
+
+		if err == nil {
+			c.send(id, gqlComplete, nil)
+			return
+		}
+
+		if _, ok := err.(*schema.RequestError); !ok {
+			entry := logging.FromContext(ctx).WithError(err).WithField("operation_id", id)
+			if apperr.From(err).Code == apperr.Internal {
+				entry.Error("Subscription failed")
+			} else {
+				entry.Debug("Subscription ended")
+			}
+		}
+
+		c.sendError(id, err)
+	}()
+}
+
+func (c *connection) stop(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cancel, ok := c.operations[id]; ok {
+		cancel()
+		delete(c.operations, id)
+	}
+}
+
+func (c *connection) stopAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, cancel := range c.operations {
+		cancel()
+		delete(c.operations, id)
+	}
+}
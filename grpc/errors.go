@@ -0,0 +1,50 @@
+package grpc
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Turn errors that aren't a status yet into typed ones, internal details are logged and hidden
+func toStatus(ctx context.Context, fullMethod string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch err {
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	appErr := apperr.From(err)
+	if appErr.Code == apperr.Internal {
+		logging.FromContext(ctx).WithError(err).Error("Failed to handle " + fullMethod)
+	}
+
+	return appErr
+}
+
+// UnaryErrorInterceptor answers with the status matching the error of the handler
+func UnaryErrorInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		res, err := handler(ctx, req)
+		return res, toStatus(ctx, info.FullMethod, err)
+	}
+}
+
+// StreamErrorInterceptor is the streaming counterpart of UnaryErrorInterceptor
+func StreamErrorInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return toStatus(ss.Context(), info.FullMethod, handler(srv, ss))
+	}
+}
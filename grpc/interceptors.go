@@ -0,0 +1,114 @@
+package grpc
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+// Read the bearer token from the `authorization` metadata entry
+func extractToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+
+	strArr := strings.Split(values[0], " ")
+	if len(strArr) == 2 && strings.EqualFold(strArr[0], "bearer") {
+		return strArr[1]
+	}
+
+	return ""
+}
+
+// Calls that don't need a caller, the health service has to answer probes without a token
+func public(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/")
+}
+
+// The scope a long lived token needs for each call, calls missing here are reserved to regular sessions
+var methodScopes = map[string]auth.Scope{
+	"/chat.ChatService/Friends":        auth.ScopeUsersRead,
+	"/chat.ChatService/Messages":       auth.ScopeChatRead,
+	"/chat.ChatService/RecentMessages": auth.ScopeChatRead,
+	"/chat.ChatService/StreamMessages": auth.ScopeChatRead,
+	"/chat.ChatService/SaveMessage":    auth.ScopeChatWrite,
+}
+
+func authenticate(ctx context.Context, s *store.Store, fullMethod string) (context.Context, error) {
+	identity, err := auth.AuthenticateToken(ctx, extractToken(ctx), s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !identity.Allows(methodScopes[fullMethod]) {
+		return nil, auth.ErrMissingScope
+	}
+
+	return auth.NewContext(ctx, identity, nil), nil
+}
+
+// UnaryAuthInterceptor rejects calls without a valid access token and stores the caller identity in the context
+func UnaryAuthInterceptor(s *store.Store) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if public(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		ctx, err := authenticate(ctx, s, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// Hand a derived context to the stream handler
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamAuthInterceptor is the streaming counterpart of UnaryAuthInterceptor
+func StreamAuthInterceptor(s *store.Store) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if public(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		ctx, err := authenticate(ss.Context(), s, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &contextStream{ss, ctx})
+	}
+}
+
+// Resolve the acting user from the token, a user id claimed in the payload must match it
+func actingUser(ctx context.Context, claimed string) (string, error) {
+	identity, err := auth.FromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if claimed != "" && claimed != identity.UserId {
+		return "", apperr.New(apperr.Forbidden, "Acting as another user is not allowed")
+	}
+
+	return identity.UserId, nil
+}
@@ -0,0 +1,118 @@
+package grpc
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/gloompi/tantora-back/app/store/storetest"
+	"github.com/gloompi/tantora-back/app/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+// A context carrying a new API key of user 2 with the given scopes
+func withAPIKey(t *testing.T, fakes *storetest.Fakes, scopes ...string) context.Context {
+	t.Helper()
+
+	key, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fakes.APIKeys.Create(context.Background(), store.NewAPIKey{
+		UserId: "2",
+		Name:   "bot",
+		Prefix: prefix,
+		Hash:   hash,
+		Scopes: scopes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+key))
+}
+
+func TestAuthInterceptorsEnforceMethodScopes(t *testing.T) {
+	fakes := storetest.New()
+	fakes.AddUser("2")
+
+	ctx := withAPIKey(t, fakes, string(auth.ScopeChatRead))
+
+	unary := UnaryAuthInterceptor(fakes.Store())
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		identity, err := auth.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return identity.UserId, nil
+	}
+
+	tests := []struct {
+		method  string
+		allowed bool
+	}{
+		{"/chat.ChatService/Messages", true},
+		{"/chat.ChatService/RecentMessages", true},
+		{"/chat.ChatService/SaveMessage", false},
+		{"/chat.ChatService/Friends", false},
+		// calls without a scope are reserved to regular sessions
+		{"/chat.ChatService/Unlisted", false},
+	}
+
+	for _, test := range tests {
+		res, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: test.method}, handler)
+
+		if test.allowed && (err != nil || res != "2") {
+			t.Errorf("%s: got %v, %v", test.method, res, err)
+		}
+		if !test.allowed && err != auth.ErrMissingScope {
+			t.Errorf("%s: got %v, want ErrMissingScope", test.method, err)
+		}
+	}
+
+	stream := StreamAuthInterceptor(fakes.Store())
+	streamHandler := func(srv interface{}, ss grpc.ServerStream) error {
+		_, err := auth.FromContext(ss.Context())
+		return err
+	}
+
+	err := stream(nil, &fakeStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/chat.ChatService/StreamMessages"}, streamHandler)
+	if err != nil {
+		t.Fatalf("streaming with chat:read got %v", err)
+	}
+
+	writeOnly := withAPIKey(t, fakes, string(auth.ScopeChatWrite))
+	err = stream(nil, &fakeStream{ctx: writeOnly}, &grpc.StreamServerInfo{FullMethod: "/chat.ChatService/StreamMessages"}, streamHandler)
+	if err != auth.ErrMissingScope {
+		t.Fatalf("streaming with chat:write got %v, want ErrMissingScope", err)
+	}
+}
+
+func TestAuthInterceptorRejectsMissingAndUnknownKeys(t *testing.T) {
+	fakes := storetest.New()
+	unary := UnaryAuthInterceptor(fakes.Store())
+	info := &grpc.UnaryServerInfo{FullMethod: "/chat.ChatService/Messages"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	unknown := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer tnt_unknown"))
+
+	for name, ctx := range map[string]context.Context{"no token": context.Background(), "unknown key": unknown} {
+		if _, err := unary(ctx, nil, info, handler); apperr.From(err).Code != apperr.Unauthenticated {
+			t.Errorf("%s: got %v, want UNAUTHENTICATED", name, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package grpc
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// Tag the context with the request id of the call and send it back in the response header
+func startLogging(ctx context.Context, fullMethod string) context.Context {
+	var given string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(logging.RequestIDHeader); len(values) > 0 {
+			given = values[0]
+		}
+	}
+
+	requestId := logging.RequestID(given)
+	grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(logging.RequestIDHeader), requestId))
+
+	return logging.NewRequest(ctx, requestId, logrus.Fields{"method": fullMethod})
+}
+
+func logCall(ctx context.Context, started time.Time, err error) {
+	code := status.Code(err)
+	entry := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"code":        code.String(),
+		"duration_ms": time.Since(started).Milliseconds(),
+	})
+
+	switch code {
+	case codes.OK, codes.Canceled:
+		entry.Info("Call finished")
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unavailable:
+		entry.WithError(err).Error("Call failed")
+	default:
+		entry.WithError(err).Warn("Call failed")
+	}
+}
+
+// UnaryLoggingInterceptor logs every call with its request id, status and duration
+func UnaryLoggingInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		started := time.Now()
+		ctx = startLogging(ctx, info.FullMethod)
+
+		res, err := handler(ctx, req)
+		logCall(ctx, started, err)
+		return res, err
+	}
+}
+
+// StreamLoggingInterceptor is the streaming counterpart of UnaryLoggingInterceptor
+func StreamLoggingInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		started := time.Now()
+		ctx := startLogging(ss.Context(), info.FullMethod)
+
+		err := handler(srv, &contextStream{ss, ctx})
+		logCall(ctx, started, err)
+		return err
+	}
+}
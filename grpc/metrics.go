@@ -0,0 +1,48 @@
+package grpc
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+var (
+	handledTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "RPCs completed on the server by method and status code.",
+	}, []string{"method", "code"})
+
+	handlingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Time taken by the server to complete an RPC.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+func observe(method string, started time.Time, err error) {
+	handlingSeconds.WithLabelValues(method).Observe(time.Since(started).Seconds())
+	handledTotal.WithLabelValues(method, status.Code(err).String()).Inc()
+}
+
+// UnaryMetricsInterceptor records the latency and status code of every call
+func UnaryMetricsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		started := time.Now()
+		res, err := handler(ctx, req)
+		observe(info.FullMethod, started, err)
+		return res, err
+	}
+}
+
+// StreamMetricsInterceptor is the streaming counterpart of UnaryMetricsInterceptor
+func StreamMetricsInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		started := time.Now()
+		err := handler(srv, ss)
+		observe(info.FullMethod, started, err)
+		return err
+	}
+}
@@ -2,59 +2,44 @@ package grpc
 
 import (
 	"context"
-	"encoding/hex"
-	"fmt"
-	"github.com/gloompi/tantora-back/app/dbConnection"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/events"
+	"github.com/gloompi/tantora-back/app/logging"
 	"github.com/gloompi/tantora-back/app/proto/tantorapb"
+	"github.com/gloompi/tantora-back/app/store"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
 )
 
-var connection = dbConnection.ReadConnection()
+type Server struct {
+	Store *store.Store
 
-type Server struct{}
-
-func (*Server) Friends(_ context.Context, req *tantorapb.FriendsRequest) (*tantorapb.FriendsResponse, error) {
-	userId := req.GetUserId()
+	// Closing ends the open message streams so that the server can drain
+	Closing <-chan struct{}
+}
 
-	if len(userId) == 0 {
-		return nil, status.Errorf(codes.InvalidArgument, "Received an empty userId")
+func (s *Server) Friends(ctx context.Context, req *tantorapb.FriendsRequest) (*tantorapb.FriendsResponse, error) {
+	userId, err := actingUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
 	}
 
-	query := fmt.Sprintf(`
-		select
-			f.friend_id,
-			u.user_name,
-			u.first_name,
-			u.last_name
-		from friends f
-			inner join users as u
-			on f.friend_id = u.user_id
-		where f.user_id = %v;
-	`, userId)
-
-	rows, err := connection.DB.Query(query)
+	rows, err := s.Store.Friends.List(ctx, userId)
 	if err != nil {
 		return nil, err
 	}
 
 	var friends []*tantorapb.Friend
 
-	for rows.Next() {
-		friend := &tantorapb.Friend{}
-
-		err := rows.Scan(
-			&friend.FriendId,
-			&friend.UserName,
-			&friend.FirstName,
-			&friend.LastName,
-		)
-
-		if err != nil {
-			return nil, err
-		}
-
-		friends = append(friends, friend)
+	for _, row := range rows {
+		friends = append(friends, &tantorapb.Friend{
+			FriendId:  row.FriendId,
+			UserName:  row.UserName,
+			FirstName: row.FirstName,
+			LastName:  row.LastName,
+		})
 	}
 
 	res := &tantorapb.FriendsResponse{
@@ -64,67 +49,28 @@ func (*Server) Friends(_ context.Context, req *tantorapb.FriendsRequest) (*tanto
 	return res, nil
 }
 
-func (*Server) RecentMessages(_ context.Context, req *tantorapb.RecentMessagesRequest) (*tantorapb.RecentMessagesResponse, error) {
-	userId := req.GetUserId()
-
-	if len(userId) == 0 {
-		return nil, status.Errorf(codes.InvalidArgument, "Received empty userId")
-	}
-
-	query := fmt.Sprintf(`
-		select
-			case
-				when u2.receiver_id = %v then u2.sender_id
-				else u2.receiver_id
-			end as receiver_id,
-			u2.user_name,
-			u2.first_name,
-			u2.last_name,
-			u2.created_date
-		from
-			(select
-				distinct on(u.user_name) user_name,
-				receiver_id,
-				sender_id,
-				u.first_name,
-				u.last_name,
-				created_date
-			from (select distinct on(receiver_id) receiver_id, sender_id, created_date
-				from message
-				where sender_id = %v or receiver_id = %v
-				order by receiver_id, created_date desc) message
-				inner join users as u on
-				(case
-					when receiver_id = %v then sender_id = u.user_id
-					when sender_id = %v then receiver_id = user_id
-				end)
-			) as u2
-		order by created_date desc;
-	`, userId, userId, userId, userId, userId)
-
-	rows, err := connection.DB.Query(query)
+func (s *Server) RecentMessages(ctx context.Context, req *tantorapb.RecentMessagesRequest) (*tantorapb.RecentMessagesResponse, error) {
+	userId, err := actingUser(ctx, req.GetUserId())
 	if err != nil {
 		return nil, err
 	}
 
-	var messages []*tantorapb.RecentMessage
-
-	for rows.Next() {
-		recentMes := &tantorapb.RecentMessage{}
-
-		err := rows.Scan(
-			&recentMes.UserId,
-			&recentMes.UserName,
-			&recentMes.FirstName,
-			&recentMes.LastName,
-			&recentMes.CreatedDate,
-		)
+	rows, err := s.Store.Messages.Recent(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	var messages []*tantorapb.RecentMessage
 
-		messages = append(messages, recentMes)
+	for _, row := range rows {
+		messages = append(messages, &tantorapb.RecentMessage{
+			UserId:      row.UserId,
+			UserName:    row.UserName,
+			FirstName:   row.FirstName,
+			LastName:    row.LastName,
+			CreatedDate: row.CreatedDate.Format(time.RFC3339Nano),
+			CreatedAt:   timestamp(row.CreatedDate),
+		})
 	}
 
 	res := &tantorapb.RecentMessagesResponse{
@@ -134,111 +80,110 @@ func (*Server) RecentMessages(_ context.Context, req *tantorapb.RecentMessagesRe
 	return res, nil
 }
 
-func (*Server) Messages(_ context.Context, req *tantorapb.ChatRequest) (*tantorapb.ChatResponse, error) {
-	userId := req.GetUserId()
-	receiverId := req.GetReceiverId()
-	limit := req.GetLimit()
-	offset := req.GetOffset()
-
-	if len(userId) == 0 || len(receiverId) == 0 {
-		return nil, status.Errorf(codes.InvalidArgument, "Received an empty userId or receiverId")
+func (s *Server) Messages(ctx context.Context, req *tantorapb.ChatRequest) (*tantorapb.ChatResponse, error) {
+	userId, err := actingUser(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
 	}
 
-	if limit == 0{
-		limit = 10
+	receiverId := req.GetReceiverId()
+	invalid := map[string]string{}
+
+	if len(receiverId) == 0 {
+		invalid["receiverId"] = "is required"
 	}
 
-	query := fmt.Sprintf(`
-		select
-			m.sender_id,
-			m.receiver_id,
-			m."content",
-			m.created_date
-		from message m
-		where m.sender_id = %v and m.receiver_id = %v or m.sender_id = %v and m.receiver_id = %v
-		order by m.created_date desc
-		limit %v offset %v;
-	`, userId, receiverId, receiverId, userId, limit, offset)
+	page := store.Page{First: int(req.GetPageSize())}
 
-	rows, err := connection.DB.Query(query)
-	if err != nil {
-		return nil, err
+	// older clients send limit
+	if page.First == 0 {
+		page.First = int(req.GetLimit())
 	}
 
-	var messages []*tantorapb.ChatMessage
+	if page.First == 0 {
+		page.First = 10
+	}
 
-	for rows.Next() {
-		message := &tantorapb.ChatMessage{}
+	if page.First < 0 || page.First > 100 {
+		invalid["pageSize"] = "must be between 1 and 100"
+	}
 
-		err := rows.Scan(
-			&message.SenderId,
-			&message.ReceiverId,
-			&message.Content,
-			&message.CreatedDate,
-		)
+	if req.GetOffset() != 0 {
+		invalid["offset"] = "is no longer supported, use pageToken"
+	}
 
+	if token := req.GetPageToken(); token != "" {
+		page.After, err = store.DecodeCursor(token)
 		if err != nil {
-			return nil, err
+			invalid["pageToken"] = "is not a valid page token"
 		}
+	}
+
+	if len(invalid) > 0 {
+		return nil, apperr.Validation(invalid)
+	}
 
-		decodedStr, _ := hex.DecodeString(message.Content)
-		message.Content = string(decodedStr)
-		messages = append(messages, message)
+	rows, hasNext, err := s.Store.Messages.Conversation(ctx, userId, receiverId, page)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*tantorapb.ChatMessage
+
+	for _, row := range rows {
+		messages = append(messages, chatMessage(row))
 	}
 
 	res := &tantorapb.ChatResponse{
 		Messages: messages,
 	}
 
-	query = fmt.Sprintf(`
-		select user_name, first_name, last_name
-		from users
-		where user_id = %v;
-	`, receiverId)
+	if hasNext {
+		res.NextPageToken = store.EncodeCursor(rows[len(rows)-1].Cursor())
+	}
 
-	rows, err = connection.DB.Query(query)
-	if err != nil {
+	receiver, err := s.Store.Users.ByID(ctx, receiverId)
+	if err != nil && err != store.ErrNotFound {
 		return nil, err
 	}
 
-	for rows.Next() {
-		err := rows.Scan(
-			&res.UserName,
-			&res.FirstName,
-			&res.LastName,
-		)
-
-		if err != nil {
-			return nil, err
-		}
+	if receiver != nil {
+		res.UserName = receiver.UserName
+		res.FirstName = receiver.FirstName
+		res.LastName = receiver.LastName
 	}
 
 	return res, nil
 }
 
-func (*Server) SaveMessage(_ context.Context, req *tantorapb.SaveMessageRequest) (*tantorapb.SaveMessageResponse, error) {
+func (s *Server) SaveMessage(ctx context.Context, req *tantorapb.SaveMessageRequest) (*tantorapb.SaveMessageResponse, error) {
 	message := req.GetMessage()
 
 	if message == nil {
-		return nil, status.Errorf(codes.InvalidArgument, "Received an empty `message`")
+		return nil, apperr.Validation(map[string]string{"message": "is required"})
 	}
 
-	query := fmt.Sprintf(`
-		insert into message (
-			sender_id,
-			receiver_id,
-			"content"
-		) values ('%v', '%v', '%v');
-	`, message.GetSenderId(), message.GetReceiverId(), hex.EncodeToString([]byte(message.GetContent())))
+	if len(message.GetReceiverId()) == 0 {
+		return nil, apperr.Validation(map[string]string{"receiverId": "is required"})
+	}
 
-	stmt, err := connection.DB.Prepare(query)
+	senderId, err := actingUser(ctx, message.GetSenderId())
 	if err != nil {
 		return nil, err
 	}
 
-	defer stmt.Close()
+	saved := &store.Message{
+		SenderId:   senderId,
+		ReceiverId: message.GetReceiverId(),
+		Content:    message.GetContent(),
+	}
 
-	_, err = stmt.Exec()
+	err = s.Store.Messages.Save(ctx, saved)
+	if err == nil {
+		if err := events.PublishMessage(saved); err != nil {
+			logging.FromContext(ctx).WithError(err).Error("Failed to publish message event")
+		}
+	}
 
 	res := &tantorapb.SaveMessageResponse{
 		Status: 0,
@@ -250,3 +195,50 @@ func (*Server) SaveMessage(_ context.Context, req *tantorapb.SaveMessageRequest)
 
 	return res, err
 }
+
+func (s *Server) StreamMessages(_ *tantorapb.StreamMessagesRequest, stream tantorapb.ChatService_StreamMessagesServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	userId, err := actingUser(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		select {
+		case <-s.Closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = events.SubscribeMessages(ctx, userId, func(message *store.Message) error {
+		return stream.Send(chatMessage(message))
+	})
+
+	if err == events.ErrClosed {
+		return status.Errorf(codes.Unavailable, "Message stream was closed")
+	}
+
+	if err == context.Canceled && stream.Context().Err() == nil {
+		return status.Errorf(codes.Unavailable, "Server is shutting down")
+	}
+
+	return err
+}
+
+// created_date is still filled in for clients that predate created_at
+func chatMessage(m *store.Message) *tantorapb.ChatMessage {
+	return &tantorapb.ChatMessage{
+		SenderId:    m.SenderId,
+		ReceiverId:  m.ReceiverId,
+		Content:     m.Content,
+		CreatedDate: m.CreatedDate.Format(time.RFC3339Nano),
+		CreatedAt:   timestamp(m.CreatedDate),
+	}
+}
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	return &timestamppb.Timestamp{Seconds: t.Unix(), Nanos: int32(t.Nanosecond())}
+}
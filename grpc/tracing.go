@@ -0,0 +1,72 @@
+package grpc
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/tracing"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+// Read and write the trace context from gRPC metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Continue the trace given in the traceparent metadata entry with a span for the call
+func startCall(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+	// fullMethod looks like /chat.ChatService/Messages
+	service, method := "", fullMethod
+	if parts := strings.SplitN(strings.TrimPrefix(fullMethod, "/"), "/", 2); len(parts) == 2 {
+		service, method = parts[0], parts[1]
+	}
+
+	return tracing.Tracer().Start(ctx, strings.TrimPrefix(fullMethod, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.RPCSystemGRPC, semconv.RPCService(service), semconv.RPCMethod(method)),
+	)
+}
+
+// UnaryTracingInterceptor records a span for every call
+func UnaryTracingInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startCall(ctx, info.FullMethod)
+		res, err := handler(ctx, req)
+		tracing.End(span, err)
+		return res, err
+	}
+}
+
+// StreamTracingInterceptor is the streaming counterpart of UnaryTracingInterceptor
+func StreamTracingInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startCall(ss.Context(), info.FullMethod)
+		err := handler(srv, &contextStream{ss, ctx})
+		tracing.End(span, err)
+		return err
+	}
+}
@@ -0,0 +1,162 @@
+// Package healthcheck reports whether the app and the services it depends on are usable, over HTTP for
+// the orchestrator probes and through the grpc.health.v1 service.
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gloompi/tantora-back/app/logging"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// how long a single dependency may take to answer
+const checkTimeout = 2 * time.Second
+
+// Check returns an error when the dependency can't be used
+type Check func(ctx context.Context) error
+
+type Checker struct {
+	checks map[string]Check
+
+	mu       sync.RWMutex
+	stopping bool
+}
+
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func New(checks map[string]Check) *Checker {
+	return &Checker{checks: checks}
+}
+
+// Run every check concurrently, the result holds the error of each failed one
+func (c *Checker) Run(ctx context.Context) map[string]error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := map[string]error{}
+
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			if err := check(ctx); err != nil {
+				mu.Lock()
+				failed[name] = err
+				mu.Unlock()
+			}
+		}(name, check)
+	}
+
+	wg.Wait()
+
+	return failed
+}
+
+// Shutdown marks the app as not ready so no new traffic is routed to it while draining
+func (c *Checker) Shutdown() {
+	c.mu.Lock()
+	c.stopping = true
+	c.mu.Unlock()
+}
+
+func (c *Checker) isStopping() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.stopping
+}
+
+func (c *Checker) report(ctx context.Context) (int, report) {
+	failed := c.Run(ctx)
+
+	res := report{Status: "ok", Checks: map[string]string{}}
+	code := http.StatusOK
+
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		res.Checks[name] = "ok"
+		if err, ok := failed[name]; ok {
+			// the probes are public, the cause is only logged
+			logging.FromContext(ctx).WithError(err).WithField("check", name).Warn("Health check failed")
+			res.Checks[name] = "unavailable"
+			res.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	return code, res
+}
+
+func writeReport(w http.ResponseWriter, code int, res report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
+
+// LiveHandler answers as long as the process serves requests
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, http.StatusOK, report{Status: "ok"})
+	})
+}
+
+// HealthHandler fails when any dependency is unavailable
+func (c *Checker) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		code, res := c.report(req.Context())
+		writeReport(w, code, res)
+	})
+}
+
+// ReadyHandler fails when any dependency is unavailable or the app is shutting down
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if c.isStopping() {
+			writeReport(w, http.StatusServiceUnavailable, report{Status: "stopping"})
+			return
+		}
+
+		code, res := c.report(req.Context())
+		writeReport(w, code, res)
+	})
+}
+
+// Watch keeps the status of the given gRPC services in line with the checks, it blocks until ctx is done
+func (c *Checker) Watch(ctx context.Context, hs *health.Server, interval time.Duration, services ...string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		if len(c.Run(ctx)) > 0 {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		for _, service := range services {
+			hs.SetServingStatus(service, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthHandlerHidesErrors(t *testing.T) {
+	c := New(map[string]Check{
+		"postgres": func(ctx context.Context) error {
+			return errors.New("dial tcp 10.0.0.5:5432: connect: connection refused")
+		},
+		"redis": func(ctx context.Context) error { return nil },
+	})
+
+	rec := httptest.NewRecorder()
+	c.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	if strings.Contains(rec.Body.String(), "10.0.0.5") {
+		t.Fatalf("the response exposes the error: %s", rec.Body.String())
+	}
+
+	var res report
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Checks["postgres"] != "unavailable" || res.Checks["redis"] != "ok" {
+		t.Fatalf("got checks %v", res.Checks)
+	}
+}
@@ -0,0 +1,53 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodEdDSA signs tokens with Ed25519 keys, jwt-go v3 doesn't provide it
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+var errEdDSAVerification = errors.New("EdDSA verification failed")
+
+type signingMethodEdDSA struct{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Verify expects an ed25519.PublicKey
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return errEdDSAVerification
+	}
+
+	return nil
+}
+
+// Sign expects an ed25519.PrivateKey
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
@@ -0,0 +1,230 @@
+// Package jwks loads the asymmetric keys access tokens are signed with and publishes their public
+// halves as a JSON Web Key Set, so other services can verify tokens without sharing a secret.
+//
+// One key signs new tokens, retired keys stay in the set to verify the tokens they signed until those
+// expire. Every key is identified by its RFC 7638 thumbprint, which tokens carry in their `kid` header.
+package jwks
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+)
+
+// Path is where the key set is served
+const Path = "/.well-known/jwks.json"
+
+// RSA keys shorter than this are rejected
+const minRSABits = 2048
+
+// Key is a verification key, Private is only set for the signing key
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Public  crypto.PublicKey
+	Private crypto.Signer
+}
+
+// Set holds the signing key and every key tokens may still be verified with
+type Set struct {
+	signing *Key
+	keys    map[string]*Key
+	ordered []*Key
+}
+
+// JWK is the JSON Web Key representation of a public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// Load reads the PEM encoded private key to sign with and the public keys of retired signing keys.
+// Without a signing key the set is empty and tokens are signed with the shared secret
+func Load(signingFile string, verificationFiles []string) (*Set, error) {
+	s := &Set{keys: map[string]*Key{}}
+
+	if signingFile == "" {
+		if len(verificationFiles) > 0 {
+			return nil, errors.New("verification keys require a signing key")
+		}
+		return s, nil
+	}
+
+	signing, err := readKey(signingFile, true)
+	if err != nil {
+		return nil, err
+	}
+	s.signing = signing
+	s.add(signing)
+
+	for _, file := range verificationFiles {
+		key, err := readKey(file, false)
+		if err != nil {
+			return nil, err
+		}
+		s.add(key)
+	}
+
+	return s, nil
+}
+
+func (s *Set) add(key *Key) {
+	if _, ok := s.keys[key.ID]; ok {
+		return
+	}
+
+	s.keys[key.ID] = key
+	s.ordered = append(s.ordered, key)
+}
+
+// Signing returns the key new tokens are signed with, nil when the set is empty
+func (s *Set) Signing() *Key {
+	return s.signing
+}
+
+// Lookup finds a verification key by its id
+func (s *Set) Lookup(kid string) (*Key, bool) {
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// JWKs renders the public keys, the signing key first
+func (s *Set) JWKs() []JWK {
+	list := []JWK{}
+	for _, key := range s.ordered {
+		list = append(list, jwk(key))
+	}
+	return list
+}
+
+// Handler serves the key set, clients may cache it for a few minutes
+func (s *Set) Handler() http.Handler {
+	body, _ := json.Marshal(map[string]interface{}{"keys": s.JWKs()})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Write(body)
+	})
+}
+
+// Read a PEM file, private keys are accepted for verification too and only their public half is kept
+func readKey(file string, signing bool) (*Key, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s holds no PEM data", file)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s holds an unsupported %s block", file, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", file, err)
+	}
+
+	key := &Key{}
+
+	if private, ok := parsed.(crypto.Signer); ok {
+		key.Private = private
+		key.Public = private.Public()
+	} else {
+		key.Public = parsed
+	}
+
+	if signing && key.Private == nil {
+		return nil, fmt.Errorf("%s must hold a private key to sign with", file)
+	}
+
+	if !signing {
+		key.Private = nil
+	}
+
+	switch public := key.Public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%s holds an RSA key shorter than %d bits", file, minRSABits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s holds neither an RSA nor an Ed25519 key", file)
+	}
+
+	key.ID = thumbprint(jwk(key))
+
+	return key, nil
+}
+
+func jwk(key *Key) JWK {
+	k := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+	switch public := key.Public.(type) {
+	case *rsa.PublicKey:
+		k.Kty = "RSA"
+		k.N = encode(public.N.Bytes())
+		k.E = encode(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		k.Kty = "OKP"
+		k.Crv = "Ed25519"
+		k.X = encode(public)
+	}
+
+	return k
+}
+
+// RFC 7638 thumbprint, the hash of the required members in lexicographic order
+func thumbprint(k JWK) string {
+	var members string
+	if k.Kty == "RSA" {
+		members = `{"e":"` + k.E + `","kty":"RSA","n":"` + k.N + `"}`
+	} else {
+		members = `{"crv":"` + k.Crv + `","kty":"` + k.Kty + `","x":"` + k.X + `"}`
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return encode(sum[:])
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,34 @@
+// Package loader batches and caches the lookups made while resolving one GraphQL request, so a list
+// of exhibitions loads all of their owners with a single query.
+//
+// Load registers the key and returns a thunk; graphql-go resolves the fields of a whole level before
+// calling the thunks, and the first call runs the batch for every key registered so far.
+package loader
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/store"
+)
+
+type contextKey struct{}
+
+// Loaders holds the loaders of one request
+type Loaders struct {
+	Users *UserLoader
+}
+
+func New(s *store.Store) *Loaders {
+	return &Loaders{
+		Users: newUserLoader(s.Users),
+	}
+}
+
+func NewContext(ctx context.Context, loaders *Loaders) context.Context {
+	return context.WithValue(ctx, contextKey{}, loaders)
+}
+
+// FromContext returns the loaders of the request, nil outside of one
+func FromContext(ctx context.Context) *Loaders {
+	loaders, _ := ctx.Value(contextKey{}).(*Loaders)
+	return loaders
+}
@@ -0,0 +1,76 @@
+package loader
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/store"
+	"sync"
+)
+
+type userBatch struct {
+	ids   []string
+	done  bool
+	users map[string]*store.User
+	err   error
+}
+
+// UserLoader loads users by id
+type UserLoader struct {
+	users store.UserStore
+
+	mu      sync.Mutex
+	batches map[string]*userBatch
+	pending *userBatch
+}
+
+func newUserLoader(users store.UserStore) *UserLoader {
+	return &UserLoader{users: users, batches: map[string]*userBatch{}}
+}
+
+// Load returns a thunk resolving to the user, store.ErrNotFound when there is none.
+// Every id is fetched at most once per request
+func (l *UserLoader) Load(ctx context.Context, userId string) func() (*store.User, error) {
+	l.mu.Lock()
+	b, ok := l.batches[userId]
+	if !ok {
+		if l.pending == nil {
+			l.pending = &userBatch{}
+		}
+
+		b = l.pending
+		b.ids = append(b.ids, userId)
+		l.batches[userId] = b
+	}
+	l.mu.Unlock()
+
+	return func() (*store.User, error) {
+		l.run(ctx, b)
+
+		if b.err != nil {
+			return nil, b.err
+		}
+
+		user, ok := b.users[userId]
+		if !ok {
+			return nil, store.ErrNotFound
+		}
+
+		return user, nil
+	}
+}
+
+func (l *UserLoader) run(ctx context.Context, b *userBatch) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b.done {
+		return
+	}
+
+	// ids requested from now on go into a new batch
+	if l.pending == b {
+		l.pending = nil
+	}
+
+	b.users, b.err = l.users.ByIDs(ctx, b.ids)
+	b.done = true
+}
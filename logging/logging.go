@@ -0,0 +1,87 @@
+// Package logging provides the structured, leveled logger of the app. Request handlers carry a logger
+// with the request id and, once authenticated, the user id in their context.
+package logging
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/config"
+	"github.com/sirupsen/logrus"
+	"github.com/twinj/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+)
+
+// Header and metadata key carrying the request id, a valid one sent by the caller is kept
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey struct{}
+
+var root = logrus.New()
+
+func init() {
+	root.SetOutput(os.Stderr)
+	root.SetFormatter(&logrus.JSONFormatter{})
+}
+
+// Init applies the configured level and format
+func Init(conf config.Log) error {
+	level, err := logrus.ParseLevel(conf.Level)
+	if err != nil {
+		return err
+	}
+
+	root.SetLevel(level)
+
+	if conf.Format == "logfmt" {
+		root.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	} else {
+		root.SetFormatter(&logrus.JSONFormatter{})
+	}
+
+	return nil
+}
+
+// Logger returns the logger for code that doesn't serve a request
+func Logger() *logrus.Entry {
+	return logrus.NewEntry(root)
+}
+
+// FromContext returns the logger of the request, or the root logger outside of one
+func FromContext(ctx context.Context) *logrus.Entry {
+	if ctx != nil {
+		if entry, ok := ctx.Value(contextKey{}).(*logrus.Entry); ok {
+			return entry
+		}
+	}
+
+	return Logger()
+}
+
+// WithFields returns a context whose logger adds the given fields
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	return context.WithValue(ctx, contextKey{}, FromContext(ctx).WithFields(fields))
+}
+
+// NewRequest returns a context whose logger is tagged with the request id and the active trace
+func NewRequest(ctx context.Context, requestId string, fields logrus.Fields) context.Context {
+	if fields == nil {
+		fields = logrus.Fields{}
+	}
+
+	fields["request_id"] = requestId
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID().String()
+	}
+
+	return WithFields(ctx, fields)
+}
+
+// RequestID keeps the id given by the caller when it looks sane, otherwise makes a new one
+func RequestID(given string) string {
+	if given != "" && len(given) <= 128 {
+		return given
+	}
+
+	return uuid.NewV4().String()
+}
@@ -2,69 +2,247 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"fmt"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/certs"
+	"github.com/gloompi/tantora-back/app/config"
 	"github.com/gloompi/tantora-back/app/dbConnection"
+	"github.com/gloompi/tantora-back/app/events"
+	"github.com/gloompi/tantora-back/app/graphqlws"
 	grpcServer "github.com/gloompi/tantora-back/app/grpc"
+	"github.com/gloompi/tantora-back/app/healthcheck"
+	"github.com/gloompi/tantora-back/app/jwks"
+	"github.com/gloompi/tantora-back/app/loader"
+	"github.com/gloompi/tantora-back/app/logging"
 	"github.com/gloompi/tantora-back/app/proto/tantorapb"
 	schemaPkg "github.com/gloompi/tantora-back/app/schema"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/gloompi/tantora-back/app/tokenapi"
+	"github.com/gloompi/tantora-back/app/tracing"
 	"github.com/gloompi/tantora-back/app/utils"
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/handler"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
-	"io"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 )
 
-var conf config
+const (
+	// how often the TLS certificate files are checked for changes
+	certReloadInterval = 30 * time.Second
+	// how often the gRPC health status is refreshed
+	healthInterval = 10 * time.Second
+	// how long the buffered spans get to reach the exporter, the drain deadline may already be spent
+	traceFlushTimeout = 5 * time.Second
+)
+
+var conf *config.Config
 var db *sql.DB
+var stores *store.Store
+var checker *healthcheck.Checker
+var signingKeys *jwks.Set
 
-func init() {
-	conf = readConfig()
-	db = dbConnection.ReadConnection().DB
+func openDatabase() {
+	db = dbConnection.ReadConnection(conf.Postgres).DB
+	stores = store.New(db)
 }
 
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	var err error
+	conf, err = config.Load()
+	if err != nil {
+		logging.Logger().Fatal(err)
+	}
+
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			logging.Logger().Fatal(err)
+		}
+		return
+	}
+
+	if err := conf.Validate(); err != nil {
+		logging.Logger().Fatal(err)
+	}
+
+	if err := logging.Init(conf.Log); err != nil {
+		logging.Logger().Fatal(err)
+	}
+
+	// validated above
+	trustedProxies, _ := conf.HTTP.TrustedNetworks()
+	utils.InitTrustedProxies(trustedProxies)
+
+	if err := utils.InitRedis(conf.Redis); err != nil {
+		logging.Logger().WithError(err).Fatal("Failed to connect to redis")
+	}
+
+	signingKeys, err = jwks.Load(conf.JWT.SigningKeyFile, conf.JWT.VerificationKeyFiles)
+	if err != nil {
+		logging.Logger().WithError(err).Fatal("Failed to load the JWT keys")
+	}
+
+	utils.InitTokens(conf.JWT, signingKeys)
+
+	if err := tracing.Init(conf.Tracing); err != nil {
+		logging.Logger().WithError(err).Fatal("Failed to set up tracing")
+	}
+	openDatabase()
+
+	// closed when the app starts stopping, ends the long lived streams and background jobs
+	stopping, stop := context.WithCancel(context.Background())
+
+	checker = healthcheck.New(map[string]healthcheck.Check{
+		"postgres": db.PingContext,
+		"redis": func(context.Context) error {
+			return utils.PingRedis()
+		},
+	})
 
-	lisCh := make(chan net.Listener, 1)
-	grpcSCh := make(chan *grpc.Server, 1)
+	httpS := newHttpServer(stopping)
+	grpcS, lis := newGRPCServer(stopping)
 
-	go initGRPCServer(lisCh, grpcSCh)
-	go initHttpServer()
+	errCh := make(chan error, 2)
+
+	go func() {
+		var err error
+		if httpS.TLSConfig != nil {
+			logging.Logger().Infof("Open the following URL in the browser: https://localhost:%d", conf.HTTP.Port)
+			err = httpS.ListenAndServeTLS("", "")
+		} else {
+			logging.Logger().Infof("Open the following URL in the browser: http://localhost:%d", conf.HTTP.Port)
+			err = httpS.ListenAndServe()
+		}
+
+		if err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	go func() {
+		logging.Logger().WithField("port", conf.GRPC.Port).Info("Starting GRPC server")
+		if err := grpcS.Serve(lis); err != nil {
+			errCh <- err
+		}
+	}()
+
+	go events.WatchExhibitionStarts(stopping, stores.Exhibitions, 30*time.Second)
 
 	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, os.Interrupt)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+
+	exitCode := 0
+
+	select {
+	case sig := <-ch:
+		logging.Logger().WithField("signal", sig.String()).Info("Stopping the app")
+	case err := <-errCh:
+		logging.Logger().WithError(err).Error("Server failed")
+		exitCode = 1
+	}
+
+	stop()
+	checker.Shutdown()
 
-	<-ch
-	lis := <-lisCh
-	s := <-grpcSCh
+	if !shutdown(httpS, grpcS, conf.ShutdownTimeout) {
+		exitCode = 1
+	}
 
-	fmt.Println("\nStopping the app...")
-	s.Stop()
-	lis.Close()
-	fmt.Println("Everything is closed properly!")
+	if exitCode == 0 {
+		logging.Logger().Info("Everything is closed properly")
+	}
+
+	os.Exit(exitCode)
 }
 
-// HTTP Server
-func initHttpServer() {
-	listenAt := fmt.Sprintf(":%d", conf.port)
-	fmt.Println("DB-CONNECTION------", db.Ping())
+// Drain both servers within timeout and release the connections, reports whether draining finished in time
+func shutdown(httpS *http.Server, grpcS *grpc.Server, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	drained := make(chan bool, 2)
+
+	go func() {
+		err := httpS.Shutdown(ctx)
+		if err != nil {
+			logging.Logger().WithError(err).Error("HTTP server didn't drain")
+		}
+		drained <- err == nil
+	}()
+
+	go func() {
+		done := make(chan struct{})
+		go func() {
+			grpcS.GracefulStop()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			drained <- true
+		case <-ctx.Done():
+			logging.Logger().WithError(ctx.Err()).Error("GRPC server didn't drain")
+			grpcS.Stop()
+			drained <- false
+		}
+	}()
+
+	ok := <-drained
+	ok = <-drained && ok
 
-	defer db.Close()
+	if err := utils.CloseRedis(); err != nil {
+		logging.Logger().WithError(err).Error("Failed to close redis")
+	}
+
+	if err := db.Close(); err != nil {
+		logging.Logger().WithError(err).Error("Failed to close database")
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), traceFlushTimeout)
+	defer cancelFlush()
+
+	if err := tracing.Shutdown(flushCtx); err != nil {
+		logging.Logger().WithError(err).Error("Failed to flush traces")
+	}
+
+	return ok
+}
+
+// Load the certificates of a listener and keep them fresh until ctx is done
+func loadTLS(ctx context.Context, t config.TLS) *tls.Config {
+	r, err := certs.New(t)
+	if err != nil {
+		logging.Logger().WithError(err).Fatal("Failed loading certificates")
+	}
+
+	go r.Watch(ctx, certReloadInterval)
 
+	return r.TLSConfig()
+}
+
+// HTTP Server
+func newHttpServer(stopping context.Context) *http.Server {
 	// graphql
-	schema, err := graphql.NewSchema(*schemaPkg.ReadSchema())
+	schema, err := graphql.NewSchema(*schemaPkg.ReadSchema(stores))
 	if err != nil {
-		log.Fatalln(err)
+		logging.Logger().Fatal(err)
 	}
 
+	schemaPkg.Instrument(schema)
+
 	h := handler.New(&handler.Config{
 		Schema:     &schema,
 		Pretty:     true,
@@ -73,52 +251,96 @@ func initHttpServer() {
 	})
 
 	// route handlers
-	http.HandleFunc("/generate-live-token", handleLiveToken)
-	http.Handle("/graphql", corsMiddleware(requestMiddleware(h)))
-	log.Printf("Open the following URL in the browser: http://localhost:%d\n", conf.port)
-	log.Fatal(http.ListenAndServe(listenAt, nil))
+	mux := http.NewServeMux()
+	mux.Handle("/livez", checker.LiveHandler())
+	mux.Handle("/healthz", checker.HealthHandler())
+	mux.Handle("/readyz", checker.ReadyHandler())
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle(jwks.Path, signingKeys.Handler())
+	tokens := corsMiddleware(requestMiddleware(tokenapi.NewHandler(stores)))
+	mux.Handle(tokenapi.Prefix, tokens)
+	mux.Handle(tokenapi.Prefix+"/", tokens)
+	mux.Handle("/graphql", corsMiddleware(requestMiddleware(graphqlws.NewHandler(schema, stores, stopping.Done(), h))))
+
+	s := &http.Server{
+		Addr:     fmt.Sprintf(":%d", conf.HTTP.Port),
+		Handler:  mux,
+		ErrorLog: log.New(logging.Logger().WriterLevel(logrus.WarnLevel), "", 0),
+	}
+
+	if conf.HTTP.TLS.Enabled() {
+		s.TLSConfig = loadTLS(stopping, conf.HTTP.TLS)
+	}
+
+	return s
 }
 
 // GRPC Server
-func initGRPCServer(lisCh chan<- net.Listener, grpcSCh chan<- *grpc.Server) {
-	fmt.Println("Starting GRPC server")
-
-	lis, err := net.Listen("tcp", "0.0.0.0:"+strconv.Itoa(conf.grpcPort))
+func newGRPCServer(stopping context.Context) (*grpc.Server, net.Listener) {
+	lis, err := net.Listen("tcp", "0.0.0.0:"+strconv.Itoa(conf.GRPC.Port))
 	if err != nil {
-		log.Fatalf("Failed to  listen: %v", err)
+		logging.Logger().WithError(err).Fatal("Failed to listen")
 	}
 
-	lisCh <- lis
-
-	tls := false
-	opts := []grpc.ServerOption{}
+	// the error interceptors run inside the others so they all see the translated status codes
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			grpcServer.UnaryTracingInterceptor(),
+			grpcServer.UnaryLoggingInterceptor(),
+			grpcServer.UnaryMetricsInterceptor(),
+			grpcServer.UnaryErrorInterceptor(),
+			grpcServer.UnaryAuthInterceptor(stores),
+		),
+		grpc.ChainStreamInterceptor(
+			grpcServer.StreamTracingInterceptor(),
+			grpcServer.StreamLoggingInterceptor(),
+			grpcServer.StreamMetricsInterceptor(),
+			grpcServer.StreamErrorInterceptor(),
+			grpcServer.StreamAuthInterceptor(stores),
+		),
+	}
 
-	if tls {
-		certFile := "ssl/server.crt"
-		keyFile := "ssl/server.pem"
-		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
-		if err != nil {
-			log.Fatalf("Failed loading certificates: %v", err)
-		}
-		opts = append(opts, grpc.Creds(creds))
+	if conf.GRPC.TLS.Enabled() {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(loadTLS(stopping, conf.GRPC.TLS))))
 	}
 
 	s := grpc.NewServer(opts...)
-	tantorapb.RegisterChatServiceServer(s, &grpcServer.Server{})
+	tantorapb.RegisterChatServiceServer(s, &grpcServer.Server{Store: stores, Closing: stopping.Done()})
 
-	grpcSCh <- s
+	// "" stands for the server as a whole
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+	go checker.Watch(stopping, hs, healthInterval, "", "chat.ChatService")
 
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
-	}
+	go func() {
+		<-stopping.Done()
+		hs.Shutdown()
+	}()
+
+	return s, lis
 }
 
-// Provide request instance through context
-func requestMiddleware(next *handler.Handler) http.Handler {
+// Provide request instance, trace, request logger, loaders and caller identity through context
+func requestMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		ctx := context.WithValue(req.Context(), "request", req)
+		started := time.Now()
+
+		ctx, span := tracing.StartRequest(req)
+		defer span.End()
+
+		requestId := logging.RequestID(req.Header.Get(logging.RequestIDHeader))
+		w.Header().Set(logging.RequestIDHeader, requestId)
+		ctx = logging.NewRequest(ctx, requestId, logrus.Fields{"method": req.Method, "path": req.URL.Path})
 
-		next.ContextHandler(ctx, w, req)
+		ctx = context.WithValue(ctx, "request", req)
+		ctx = loader.NewContext(ctx, loader.New(stores))
+
+		identity, err := auth.Authenticate(req.WithContext(ctx), stores)
+		ctx = auth.NewContext(ctx, identity, err)
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+
+		logging.FromContext(ctx).WithField("duration_ms", time.Since(started).Milliseconds()).Info("Request handled")
 	})
 }
 
@@ -128,31 +350,8 @@ func corsMiddleware(next http.Handler) http.Handler {
 		// allow cross domain AJAX requests
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, DELETE, PUT")
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization,Origin,X-Requested-With,Content-Type,Accept")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization,Origin,X-Requested-With,Content-Type,Accept,X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		next.ServeHTTP(w, req)
 	})
 }
-
-// Generate live token
-func handleLiveToken(w http.ResponseWriter, req *http.Request) {
-	userId, ok := req.URL.Query()["userId"]
-
-	if !ok || len(userId[0]) < 1 {
-		io.WriteString(w, "Please provide correct user id")
-		return
-	}
-
-	td, err := utils.CreateLiveToken(userId[0])
-	if err != nil {
-		io.WriteString(w, "Failed while creating a token")
-		return
-	}
-
-	err = utils.CreateAuth(userId[0], td)
-	if err != nil {
-		io.WriteString(w, "Failed while creating an auth")
-		return
-	}
-
-	io.WriteString(w, "Everything is fine, here is your token "+td.AccessToken)
-}
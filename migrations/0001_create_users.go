@@ -0,0 +1,24 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "create_users",
+		Up: `
+			create table if not exists users (
+				user_id serial primary key,
+				user_name text not null unique,
+				first_name text not null,
+				last_name text not null,
+				email text not null,
+				phone text not null default '',
+				date_of_birth date not null,
+				is_active boolean not null default false,
+				"password" text not null
+			);
+		`,
+		Down: `
+			drop table if exists users;
+		`,
+	})
+}
@@ -0,0 +1,21 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "create_roles",
+		Up: `
+			create table if not exists admins (
+				user_id integer primary key references users (user_id) on delete cascade
+			);
+
+			create table if not exists producers (
+				user_id integer primary key references users (user_id) on delete cascade
+			);
+		`,
+		Down: `
+			drop table if exists producers;
+			drop table if exists admins;
+		`,
+	})
+}
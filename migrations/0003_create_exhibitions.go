@@ -0,0 +1,23 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "create_exhibitions",
+		Up: `
+			create table if not exists exhibitions (
+				exhibition_id serial primary key,
+				name text not null,
+				description text not null default '',
+				start_date timestamp not null,
+				created_date timestamp not null default now(),
+				owner_id integer not null references users (user_id) on delete cascade
+			);
+
+			create index if not exists exhibitions_created_date_idx on exhibitions (created_date desc);
+		`,
+		Down: `
+			drop table if exists exhibitions;
+		`,
+	})
+}
@@ -0,0 +1,18 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "create_friends",
+		Up: `
+			create table if not exists friends (
+				user_id integer not null references users (user_id) on delete cascade,
+				friend_id integer not null references users (user_id) on delete cascade,
+				primary key (user_id, friend_id)
+			);
+		`,
+		Down: `
+			drop table if exists friends;
+		`,
+	})
+}
@@ -0,0 +1,23 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "create_message",
+		Up: `
+			create table if not exists message (
+				message_id serial primary key,
+				sender_id integer not null references users (user_id) on delete cascade,
+				receiver_id integer not null references users (user_id) on delete cascade,
+				"content" text not null,
+				created_date timestamp not null default now()
+			);
+
+			create index if not exists message_sender_receiver_idx on message (sender_id, receiver_id, created_date desc);
+			create index if not exists message_receiver_idx on message (receiver_id, created_date desc);
+		`,
+		Down: `
+			drop table if exists message;
+		`,
+	})
+}
@@ -0,0 +1,22 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "add_users_created_date",
+		Up: `
+			alter table users add column if not exists created_date timestamp not null default now();
+
+			create index if not exists users_created_date_idx on users (created_date desc, user_id desc);
+			create index if not exists exhibitions_created_date_id_idx on exhibitions (created_date desc, exhibition_id desc);
+			drop index if exists exhibitions_created_date_idx;
+		`,
+		Down: `
+			create index if not exists exhibitions_created_date_idx on exhibitions (created_date desc);
+			drop index if exists exhibitions_created_date_id_idx;
+			drop index if exists users_created_date_idx;
+
+			alter table users drop column if exists created_date;
+		`,
+	})
+}
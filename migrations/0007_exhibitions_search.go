@@ -0,0 +1,30 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "exhibitions_search",
+		Up: `
+			update exhibitions
+			set description = convert_from(decode(description, 'hex'), 'UTF8')
+			where description ~ '^([0-9a-f]{2})*$';
+
+			alter table exhibitions add column if not exists end_date timestamp;
+
+			create index if not exists exhibitions_start_date_idx on exhibitions (start_date, exhibition_id);
+			create index if not exists exhibitions_owner_idx on exhibitions (owner_id);
+			create index if not exists exhibitions_search_idx on exhibitions
+				using gin (to_tsvector('english', name || ' ' || description));
+		`,
+		Down: `
+			drop index if exists exhibitions_search_idx;
+			drop index if exists exhibitions_owner_idx;
+			drop index if exists exhibitions_start_date_idx;
+
+			alter table exhibitions drop column if exists end_date;
+
+			update exhibitions
+			set description = encode(convert_to(description, 'UTF8'), 'hex');
+		`,
+	})
+}
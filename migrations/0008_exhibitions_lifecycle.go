@@ -0,0 +1,33 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "exhibitions_lifecycle",
+		Up: `
+			alter table exhibitions
+				add column if not exists status text not null default 'draft'
+					check (status in ('draft', 'scheduled', 'live', 'ended', 'archived')),
+				add column if not exists deleted_date timestamp;
+
+			-- exhibitions created so far were public
+			update exhibitions
+			set status = case
+				when end_date <= now() then 'ended'
+				when start_date <= now() then 'live'
+				else 'scheduled'
+			end;
+
+			create index if not exists exhibitions_status_idx on exhibitions (status) where deleted_date is null;
+		`,
+		Down: `
+			drop index if exists exhibitions_status_idx;
+
+			delete from exhibitions where deleted_date is not null;
+
+			alter table exhibitions
+				drop column if exists deleted_date,
+				drop column if exists status;
+		`,
+	})
+}
@@ -0,0 +1,35 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "timezone_aware_dates",
+		// timestamps were written by now() on servers running in UTC
+		Up: `
+			alter table users
+				alter column created_date type timestamptz using created_date at time zone 'UTC';
+
+			alter table exhibitions
+				alter column start_date type timestamptz using start_date at time zone 'UTC',
+				alter column end_date type timestamptz using end_date at time zone 'UTC',
+				alter column created_date type timestamptz using created_date at time zone 'UTC',
+				alter column deleted_date type timestamptz using deleted_date at time zone 'UTC';
+
+			alter table message
+				alter column created_date type timestamptz using created_date at time zone 'UTC';
+		`,
+		Down: `
+			alter table message
+				alter column created_date type timestamp using created_date at time zone 'UTC';
+
+			alter table exhibitions
+				alter column deleted_date type timestamp using deleted_date at time zone 'UTC',
+				alter column created_date type timestamp using created_date at time zone 'UTC',
+				alter column end_date type timestamp using end_date at time zone 'UTC',
+				alter column start_date type timestamp using start_date at time zone 'UTC';
+
+			alter table users
+				alter column created_date type timestamp using created_date at time zone 'UTC';
+		`,
+	})
+}
@@ -0,0 +1,37 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "create_service_tokens",
+		Up: `
+			create table if not exists service_tokens (
+				token_id text primary key,
+				user_id integer not null references users (user_id) on delete cascade,
+				label text not null,
+				scopes text[] not null,
+				expires_at timestamptz not null,
+				created_by integer references users (user_id) on delete set null,
+				created_at timestamptz not null default now(),
+				revoked_at timestamptz
+			);
+
+			create index if not exists service_tokens_created_at_idx on service_tokens (created_at desc);
+
+			create table if not exists audit_events (
+				event_id bigserial primary key,
+				actor_id integer references users (user_id) on delete set null,
+				action text not null,
+				target text not null default '',
+				details jsonb not null default '{}',
+				created_at timestamptz not null default now()
+			);
+
+			create index if not exists audit_events_created_at_idx on audit_events (created_at desc);
+		`,
+		Down: `
+			drop table if exists audit_events;
+			drop table if exists service_tokens;
+		`,
+	})
+}
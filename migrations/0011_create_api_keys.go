@@ -0,0 +1,26 @@
+package migrations
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "create_api_keys",
+		Up: `
+			create table if not exists api_keys (
+				key_id bigserial primary key,
+				user_id integer not null references users (user_id) on delete cascade,
+				name text not null,
+				prefix text not null,
+				key_hash text not null unique,
+				scopes text[] not null,
+				created_at timestamptz not null default now(),
+				last_used_at timestamptz,
+				revoked_at timestamptz
+			);
+
+			create index if not exists api_keys_user_id_idx on api_keys (user_id, created_at desc);
+		`,
+		Down: `
+			drop table if exists api_keys;
+		`,
+	})
+}
@@ -0,0 +1,174 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Migration is a numbered schema change, Up and Down are plain SQL scripts
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var registered []Migration
+
+func register(m Migration) {
+	for _, existing := range registered {
+		if existing.Version == m.Version {
+			panic(fmt.Sprintf("migration %d registered twice", m.Version))
+		}
+	}
+
+	registered = append(registered, m)
+	sort.Slice(registered, func(i, j int) bool {
+		return registered[i].Version < registered[j].Version
+	})
+}
+
+// All returns every known migration ordered by version
+func All() []Migration {
+	return append([]Migration(nil), registered...)
+}
+
+func ensureTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		create table if not exists schema_migrations (
+			version integer primary key,
+			name text not null,
+			applied_at timestamptz not null default now()
+		);
+	`)
+
+	return err
+}
+
+func applied(db *sql.DB) (map[int]time.Time, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`select version, applied_at from schema_migrations;`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	versions := map[int]time.Time{}
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		versions[version] = appliedAt
+	}
+
+	return versions, rows.Err()
+}
+
+func run(db *sql.DB, script string, record func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(script); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Up applies every pending migration and returns the ones it ran
+func Up(db *sql.DB) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+
+	for _, m := range registered {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+
+		m := m
+		err := run(db, m.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`insert into schema_migrations (version, name) values ($1, $2);`, m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %d_%s: %v", m.Version, m.Name, err)
+		}
+
+		ran = append(ran, m)
+	}
+
+	return ran, nil
+}
+
+// Down rolls back the latest applied migration, it returns nil when nothing is applied
+func Down(db *sql.DB) (*Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(registered) - 1; i >= 0; i-- {
+		m := registered[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+
+		err := run(db, m.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`delete from schema_migrations where version = $1;`, m.Version)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migration %d_%s: %v", m.Version, m.Name, err)
+		}
+
+		return &m, nil
+	}
+
+	return nil, nil
+}
+
+// Statuses reports which of the known migrations are applied
+func Statuses(db *sql.DB) ([]Status, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+
+	for _, m := range registered {
+		appliedAt, ok := done[m.Version]
+		statuses = append(statuses, Status{m, ok, appliedAt})
+	}
+
+	return statuses, nil
+}
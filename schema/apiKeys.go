@@ -0,0 +1,156 @@
+package schema
+
+import (
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/gloompi/tantora-back/app/utils"
+	"github.com/graphql-go/graphql"
+	"strings"
+)
+
+// how many active keys a user may hold
+const maxAPIKeys = 20
+
+// Values are the plain scope names, as stored with the keys
+var scopeType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "Scope",
+	Values: graphql.EnumValueConfigMap{
+		"USERS_READ":        &graphql.EnumValueConfig{Value: string(auth.ScopeUsersRead)},
+		"EXHIBITIONS_READ":  &graphql.EnumValueConfig{Value: string(auth.ScopeExhibitionsRead)},
+		"EXHIBITIONS_WRITE": &graphql.EnumValueConfig{Value: string(auth.ScopeExhibitionsWrite)},
+		"CHAT_READ":         &graphql.EnumValueConfig{Value: string(auth.ScopeChatRead)},
+		"CHAT_WRITE":        &graphql.EnumValueConfig{Value: string(auth.ScopeChatWrite)},
+	},
+})
+
+var apiKeyType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ApiKey",
+	Fields: graphql.Fields{
+		"keyId":      &graphql.Field{Type: graphql.String},
+		"name":       &graphql.Field{Type: graphql.String},
+		"prefix":     &graphql.Field{Type: graphql.String, Description: "The start of the key, to tell keys apart"},
+		"scopes":     &graphql.Field{Type: graphql.NewList(scopeType)},
+		"createdAt":  &graphql.Field{Type: dateTimeType},
+		"lastUsedAt": &graphql.Field{Type: dateTimeType},
+	},
+})
+
+func readMyAPIKeysSchema() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(apiKeyType),
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			identity, err := auth.FromContext(params.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			return stores.APIKeys.Of(params.Context, identity.UserId)
+		},
+	}
+}
+
+func readCreateAPIKeySchema() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewObject(graphql.ObjectConfig{
+			Name: "CreateApiKeyResponse",
+			Fields: graphql.Fields{
+				"apiKey": &graphql.Field{Type: apiKeyType},
+				"key":    &graphql.Field{Type: graphql.String, Description: "The secret, it can't be retrieved again"},
+			},
+		}),
+		Args: graphql.FieldConfigArgument{
+			"name":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			"scopes": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(scopeType)))},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			identity, err := auth.FromContext(params.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			invalid := map[string]string{}
+
+			name, _ := params.Args["name"].(string)
+			name = strings.TrimSpace(name)
+			if name == "" {
+				invalid["name"] = "is required"
+			} else if len([]rune(name)) > 100 {
+				invalid["name"] = "must be at most 100 characters"
+			}
+
+			scopes := []string{}
+			seen := map[string]bool{}
+			list, _ := params.Args["scopes"].([]interface{})
+			for _, item := range list {
+				scope, _ := item.(string)
+				if !seen[scope] {
+					seen[scope] = true
+					scopes = append(scopes, scope)
+				}
+			}
+			if len(scopes) == 0 {
+				invalid["scopes"] = "must list at least one scope"
+			}
+
+			if len(invalid) > 0 {
+				return nil, apperr.Validation(invalid)
+			}
+
+			keys, err := stores.APIKeys.Of(params.Context, identity.UserId)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(keys) >= maxAPIKeys {
+				return nil, apperr.New(apperr.FailedPrecondition, "revoke an API key before creating another one")
+			}
+
+			key, prefix, hash, err := utils.GenerateAPIKey()
+			if err != nil {
+				return nil, err
+			}
+
+			apiKey, err := stores.APIKeys.Create(params.Context, store.NewAPIKey{
+				UserId: identity.UserId,
+				Name:   name,
+				Prefix: prefix,
+				Hash:   hash,
+				Scopes: scopes,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return map[string]interface{}{"apiKey": apiKey, "key": key}, nil
+		},
+	}
+}
+
+func readRevokeAPIKeySchema() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewObject(graphql.ObjectConfig{
+			Name: "RevokeApiKeyResponse",
+			Fields: graphql.Fields{
+				"status": &graphql.Field{Type: graphql.String},
+			},
+		}),
+		Args: graphql.FieldConfigArgument{
+			"keyId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			identity, err := auth.FromContext(params.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			keyId, _ := params.Args["keyId"].(string)
+
+			if err := stores.APIKeys.Revoke(params.Context, identity.UserId, keyId); err != nil {
+				return nil, err
+			}
+
+			return map[string]interface{}{"status": "ok"}, nil
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package schema
+
+import (
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/graphql-go/graphql"
+)
+
+// The scope a long lived token needs for each authorized field, fields missing here are reserved to regular sessions
+var fieldScopes = map[string]auth.Scope{
+	"me":                   auth.ScopeUsersRead,
+	"users":                auth.ScopeUsersRead,
+	"producers":            auth.ScopeUsersRead,
+	"audience":             auth.ScopeUsersRead,
+	"admins":               auth.ScopeUsersRead,
+	"createExhibition":     auth.ScopeExhibitionsWrite,
+	"updateExhibition":     auth.ScopeExhibitionsWrite,
+	"transitionExhibition": auth.ScopeExhibitionsWrite,
+	"deleteExhibition":     auth.ScopeExhibitionsWrite,
+	"messageReceived":      auth.ScopeChatRead,
+	"exhibitionCreated":    auth.ScopeExhibitionsRead,
+	"exhibitionStarted":    auth.ScopeExhibitionsRead,
+}
+
+// Only resolve the field for authenticated callers, restricted to the given roles if any
+func authorize(field *graphql.Field, roles ...auth.Role) *graphql.Field {
+	resolve := field.Resolve
+	if resolve == nil {
+		resolve = graphql.DefaultResolveFn
+	}
+
+	field.Resolve = func(params graphql.ResolveParams) (interface{}, error) {
+		identity, err := auth.FromContext(params.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(roles) > 0 && !identity.HasAny(roles...) {
+			return nil, auth.ErrForbidden
+		}
+
+		if !identity.Allows(fieldScopes[params.Info.FieldName]) {
+			return nil, auth.ErrMissingScope
+		}
+
+		return resolve(params)
+	}
+
+	return field
+}
@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/store/storetest"
+	"github.com/graphql-go/graphql"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	schemaOnce sync.Once
+	testSchema graphql.Schema
+	testFakes  *storetest.Fakes
+)
+
+// Run the operation as the given caller against a schema backed by in-memory stores, nil for an
+// anonymous caller. The schema is built once, Instrument would wrap the shared types again otherwise
+func executeAs(t *testing.T, identity *auth.Identity, operation string) *graphql.Result {
+	t.Helper()
+
+	schemaOnce.Do(func() {
+		testFakes = storetest.New()
+		testFakes.AddUser("1", "admin")
+		testFakes.AddUser("2", "producer")
+		testFakes.AddUser("3")
+		testFakes.AddUser("4")
+
+		var err error
+		testSchema, err = graphql.NewSchema(*ReadSchema(testFakes.Store()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		Instrument(testSchema)
+	})
+
+	return graphql.Do(graphql.Params{
+		Schema:        testSchema,
+		RequestString: operation,
+		Context:       auth.NewContext(context.Background(), identity, nil),
+	})
+}
+
+// The code of the first error, empty when the operation succeeded
+func errorCode(t *testing.T, res *graphql.Result) string {
+	t.Helper()
+
+	if len(res.Errors) == 0 {
+		return ""
+	}
+
+	return fmt.Sprint(res.Errors[0].Extensions["code"])
+}
+
+var createDraft = fmt.Sprintf(`mutation { createExhibition(name: "Prints", startDate: %q, status: DRAFT) { name } }`,
+	time.Now().Add(24*time.Hour).Format(time.RFC3339))
+
+func TestFieldScopes(t *testing.T) {
+	usersRead := &auth.Identity{UserId: "1", Roles: []auth.Role{auth.RoleAdmin}, Scopes: []auth.Scope{auth.ScopeUsersRead}}
+	exhibitionsWrite := &auth.Identity{UserId: "2", Roles: []auth.Role{auth.RoleProducer}, Scopes: []auth.Scope{auth.ScopeExhibitionsWrite}}
+	everything := &auth.Identity{UserId: "1", Roles: []auth.Role{auth.RoleAdmin}, Scopes: auth.Scopes}
+
+	tests := []struct {
+		name      string
+		identity  *auth.Identity
+		operation string
+		code      string
+	}{
+		{"granted scope", usersRead, `{ admins { totalCount } }`, ""},
+		{"missing scope", usersRead, createDraft, "FORBIDDEN"},
+		{"write scope", exhibitionsWrite, createDraft, ""},
+		{"read with only a write scope", exhibitionsWrite, `{ me { userId } }`, "FORBIDDEN"},
+		{"field reserved to sessions", everything, `{ mySessions { sessionId } }`, "FORBIDDEN"},
+		{"key management reserved to sessions", everything, `mutation { revokeApiKey(keyId: "1") { status } }`, "FORBIDDEN"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := executeAs(t, test.identity, test.operation)
+
+			if code := errorCode(t, res); code != test.code {
+				t.Fatalf("got code %q, want %q: %v", code, test.code, res.Errors)
+			}
+		})
+	}
+}
+
+func TestRoleGates(t *testing.T) {
+	callers := map[string]*auth.Identity{
+		"anonymous": nil,
+		"audience":  {UserId: "3", Roles: []auth.Role{auth.RoleAudience}},
+		"producer":  {UserId: "2", Roles: []auth.Role{auth.RoleProducer}},
+		"admin":     {UserId: "1", Roles: []auth.Role{auth.RoleAdmin}},
+	}
+
+	forbiddenBelowAdmin := map[string]string{"anonymous": "UNAUTHENTICATED", "audience": "FORBIDDEN", "producer": "FORBIDDEN", "admin": ""}
+
+	tests := []struct {
+		operation string
+		codes     map[string]string
+	}{
+		{`mutation { addToAdmins(userId: "3") { userId } }`, forbiddenBelowAdmin},
+		{`mutation { addToProducer(userId: "3") { userId } }`, forbiddenBelowAdmin},
+		{`{ admins { totalCount } }`, forbiddenBelowAdmin},
+		{`{ users { totalCount } }`, forbiddenBelowAdmin},
+		{createDraft, map[string]string{"anonymous": "UNAUTHENTICATED", "audience": "FORBIDDEN", "producer": "", "admin": ""}},
+	}
+
+	for _, test := range tests {
+		for caller, identity := range callers {
+			res := executeAs(t, identity, test.operation)
+
+			if code := errorCode(t, res); code != test.codes[caller] {
+				t.Errorf("%s as %s: got code %q, want %q: %v", test.operation, caller, code, test.codes[caller], res.Errors)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"startCursor":     &graphql.Field{Type: graphql.String},
+		"endCursor":       &graphql.Field{Type: graphql.String},
+	},
+})
+
+var userConnectionType = connectionType(userType)
+
+var exhibitionConnectionType = connectionType(exhibitionType)
+
+type connection struct {
+	Edges    []*edge
+	Nodes    []interface{}
+	PageInfo *pageInfo
+	count    func(ctx context.Context) (int, error)
+}
+
+type edge struct {
+	Cursor string
+	Node   interface{}
+}
+
+type pageInfo struct {
+	HasNextPage     bool
+	HasPreviousPage bool
+	StartCursor     *string
+	EndCursor       *string
+}
+
+// Build the Relay connection type listing nodes of the given type
+func connectionType(node *graphql.Object) *graphql.Object {
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: node.Name() + "Edge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: node},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: node.Name() + "Connection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewList(edgeType)},
+			"nodes":    &graphql.Field{Type: graphql.NewList(node)},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+			"totalCount": &graphql.Field{
+				Type: graphql.Int,
+				// only counted when asked for
+				Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+					conn, ok := params.Source.(*connection)
+
+					if !ok {
+						return nil, errors.New("were not able to get the connection")
+					}
+
+					return conn.count(params.Context)
+				},
+			},
+		},
+	})
+}
+
+// Arguments of the fields returning a connection
+func connectionArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+		"after": &graphql.ArgumentConfig{Type: graphql.String},
+	}
+}
+
+// Read the page requested by the connection arguments, invalid collects the problems with them
+func pageArgs(params graphql.ResolveParams, invalid map[string]string) store.Page {
+	page := store.Page{First: defaultPageSize}
+
+	if first, ok := params.Args["first"].(int); ok {
+		page.First = first
+	}
+
+	if page.First < 1 || page.First > maxPageSize {
+		invalid["first"] = "must be between 1 and 100"
+	}
+
+	if after, ok := params.Args["after"].(string); ok && after != "" {
+		cursor, err := store.DecodeCursor(after)
+		if err != nil {
+			invalid["after"] = "is not a valid cursor"
+		}
+		page.After = cursor
+	}
+
+	return page
+}
+
+func newConnection(page store.Page, hasNext bool, count func(ctx context.Context) (int, error)) *connection {
+	return &connection{
+		Edges: []*edge{},
+		Nodes: []interface{}{},
+		PageInfo: &pageInfo{
+			HasNextPage: hasNext,
+			// the record behind the cursor precedes this page
+			HasPreviousPage: page.After != nil,
+		},
+		count: count,
+	}
+}
+
+func (c *connection) add(node interface{}, cursor store.Cursor) {
+	encoded := store.EncodeCursor(cursor)
+
+	c.Edges = append(c.Edges, &edge{Cursor: encoded, Node: node})
+	c.Nodes = append(c.Nodes, node)
+
+	if c.PageInfo.StartCursor == nil {
+		c.PageInfo.StartCursor = &encoded
+	}
+	c.PageInfo.EndCursor = &encoded
+}
+
+// Build the connection of a page of users
+func userConnection(
+	params graphql.ResolveParams,
+	list func(ctx context.Context, page store.Page) ([]*store.User, bool, error),
+	count func(ctx context.Context) (int, error),
+) (interface{}, error) {
+	invalid := map[string]string{}
+
+	page := pageArgs(params, invalid)
+	if len(invalid) > 0 {
+		return nil, apperr.Validation(invalid)
+	}
+
+	users, hasNext, err := list(params.Context, page)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := newConnection(page, hasNext, count)
+	for _, user := range users {
+		conn.add(user, user.Cursor())
+	}
+
+	return conn, nil
+}
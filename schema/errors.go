@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/logging"
+	"github.com/graphql-go/graphql"
+)
+
+// Convert resolver errors to typed ones, internal details are logged and replaced by a generic message
+func reportErrors(resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		res, err := resolve(params)
+		if err != nil {
+			return nil, report(params, err)
+		}
+
+		thunk, ok := res.(func() (interface{}, error))
+		if !ok {
+			return res, nil
+		}
+
+		return func() (interface{}, error) {
+			res, err := thunk()
+			if err != nil {
+				// graphql-go drops the extensions of errors returned by thunks but keeps those it recovers
+				panic(report(params, err))
+			}
+			return res, nil
+		}, nil
+	}
+}
+
+func report(params graphql.ResolveParams, err error) *apperr.Error {
+	appErr := apperr.From(err)
+
+	entry := logging.FromContext(params.Context).WithError(err).WithField("code", appErr.Code)
+	if appErr.Code == apperr.Internal {
+		entry.Error("Failed to resolve " + params.Info.ParentType.Name() + "." + params.Info.FieldName)
+	} else {
+		entry.Debug("Rejected " + params.Info.ParentType.Name() + "." + params.Info.FieldName)
+	}
+
+	return appErr
+}
@@ -1,85 +1,329 @@
 package schema
 
 import (
-	"encoding/hex"
+	"context"
 	"errors"
-	"fmt"
-	"github.com/gloompi/tantora-back/app/utils"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/events"
+	"github.com/gloompi/tantora-back/app/loader"
+	"github.com/gloompi/tantora-back/app/logging"
+	"github.com/gloompi/tantora-back/app/store"
 	"github.com/graphql-go/graphql"
-	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
-type Exhibition struct {
-	ExhibitionId string `json:"exhibition_id,omitempty"`
-	Name         string `json:"name,omitempty"`
-	Description  string `json:"description,omitempty"`
-	StartDate    string `json:"start_date,omitempty"`
-	CreatedDate  string `json:"created_date,omitempty"`
-	OwnerId      string `json:"owner_id,omitempty"`
-}
-
 var exhibitionType = graphql.NewObject(graphql.ObjectConfig{
 	Name: "Exhibition",
 	Fields: graphql.Fields{
 		"exhibitionId": &graphql.Field{Type: graphql.String},
 		"name":         &graphql.Field{Type: graphql.String},
 		"description":  &graphql.Field{Type: graphql.String},
-		"startDate":    &graphql.Field{Type: graphql.String},
-		"createdDate":  &graphql.Field{Type: graphql.String},
+		"startDate":    &graphql.Field{Type: dateTimeType},
+		"createdDate":  &graphql.Field{Type: dateTimeType},
+		"endDate":      &graphql.Field{Type: dateTimeType},
+		"status":       &graphql.Field{Type: exhibitionStatusType},
 		"owner": &graphql.Field{
 			Type: userType,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				exhibition, ok := params.Source.(*Exhibition)
+				exhibition, ok := params.Source.(*store.Exhibition)
 
 				if !ok {
 					return nil, errors.New("were not able to get the exhibition")
 				}
 
-				query := fmt.Sprintf(`
-					select
-						first_name,
-						last_name,
-						email,
-						date_of_birth,
-						is_active,
-						user_id,
-						phone,
-						user_name
-					from users u
-					where u.user_id = %v;
-				`, exhibition.OwnerId)
-
-				rows, err := connection.DB.Query(query)
-				if err != nil {
-					return nil, err
-				}
-
-				var user User
-
-				for rows.Next() {
-					err := rows.Scan(
-						&user.FirstName,
-						&user.LastName,
-						&user.Email,
-						&user.DateOfBirth,
-						&user.IsActive,
-						&user.UserId,
-						&user.Phone,
-						&user.UserName,
-					)
-
-					if err != nil {
-						return nil, err
-					}
+				// batch the owners of every exhibition in the response when serving a request
+				if loaders := loader.FromContext(params.Context); loaders != nil {
+					load := loaders.Users.Load(params.Context, exhibition.OwnerId)
+					return func() (interface{}, error) {
+						return ownerOrNil(load())
+					}, nil
 				}
 
-				return user, nil
+				return ownerOrNil(stores.Users.ByID(params.Context, exhibition.OwnerId))
 			},
 		},
 	},
 })
 
+var exhibitionStatusType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ExhibitionStatus",
+	Values: graphql.EnumValueConfigMap{
+		"DRAFT":     &graphql.EnumValueConfig{Value: store.StatusDraft, Description: "Only visible to its owner and admins"},
+		"SCHEDULED": &graphql.EnumValueConfig{Value: store.StatusScheduled},
+		"LIVE":      &graphql.EnumValueConfig{Value: store.StatusLive},
+		"ENDED":     &graphql.EnumValueConfig{Value: store.StatusEnded},
+		"ARCHIVED":  &graphql.EnumValueConfig{Value: store.StatusArchived, Description: "Can't be edited anymore"},
+	},
+})
+
+// Statuses listed when the filter doesn't name any
+var publicStatuses = []store.ExhibitionStatus{store.StatusScheduled, store.StatusLive, store.StatusEnded}
+
+var exhibitionTimingType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ExhibitionTiming",
+	Values: graphql.EnumValueConfigMap{
+		"UPCOMING": &graphql.EnumValueConfig{Value: store.Upcoming, Description: "Not started yet"},
+		"LIVE": &graphql.EnumValueConfig{
+			Value:       store.Live,
+			Description: "Started and not ended yet, exhibitions without an end date stay live until they are ended",
+		},
+		"PAST": &graphql.EnumValueConfig{Value: store.Past, Description: "Ended, archived or past their end date"},
+	},
+})
+
+var exhibitionSortType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ExhibitionSort",
+	Values: graphql.EnumValueConfigMap{
+		"NEWEST":         &graphql.EnumValueConfig{Value: store.Newest, Description: "Latest created first"},
+		"OLDEST":         &graphql.EnumValueConfig{Value: store.Oldest, Description: "Earliest created first"},
+		"STARTS_SOONEST": &graphql.EnumValueConfig{Value: store.StartsSoonest, Description: "Earliest start date first"},
+		"STARTS_LATEST":  &graphql.EnumValueConfig{Value: store.StartsLatest, Description: "Latest start date first"},
+		"RELEVANCE": &graphql.EnumValueConfig{
+			Value:       store.Relevance,
+			Description: "Best match first, only for searches",
+		},
+	},
+})
+
+var exhibitionFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ExhibitionFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"ownerId":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"startsAfter":  &graphql.InputObjectFieldConfig{Type: dateTimeType, Description: "Inclusive lower bound of the start date"},
+		"startsBefore": &graphql.InputObjectFieldConfig{Type: dateTimeType, Description: "Inclusive upper bound of the start date"},
+		"timing":       &graphql.InputObjectFieldConfig{Type: exhibitionTimingType},
+		"status": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewList(graphql.NewNonNull(exhibitionStatusType)),
+			Description: "Scheduled, live and ended exhibitions by default, drafts are limited to the caller's unless they're an admin",
+		},
+	},
+})
+
+const (
+	maxExhibitionNameLength = 200
+	maxDescriptionLength    = 10000
+)
+
+// Check the fields being set on an exhibition, current is nil for a new one. invalid collects the problems
+func validateExhibition(changes store.ExhibitionChanges, current *store.Exhibition, invalid map[string]string) {
+	if changes.Name != nil {
+		if length := utf8.RuneCountInString(strings.TrimSpace(*changes.Name)); length == 0 {
+			invalid["name"] = "can't be empty"
+		} else if length > maxExhibitionNameLength {
+			invalid["name"] = "must be at most " + strconv.Itoa(maxExhibitionNameLength) + " characters"
+		}
+	}
+
+	if changes.Description != nil && utf8.RuneCountInString(*changes.Description) > maxDescriptionLength {
+		invalid["description"] = "must be at most " + strconv.Itoa(maxDescriptionLength) + " characters"
+	}
+
+	var start time.Time
+	var end *time.Time
+	if current != nil {
+		start = current.StartDate
+		end = current.EndDate
+	}
+
+	if changes.StartDate != nil {
+		start = *changes.StartDate
+		if !start.After(time.Now()) {
+			invalid["startDate"] = "must be in the future"
+		}
+	}
+
+	if changes.ClearEndDate {
+		end = nil
+		if changes.EndDate != nil {
+			invalid["clearEndDate"] = "can't be combined with endDate"
+		}
+	}
+
+	if changes.EndDate != nil {
+		end = changes.EndDate
+	}
+
+	// the dates are checked together whenever either of them moves
+	if end != nil && !start.IsZero() && !end.After(start) {
+		if changes.EndDate != nil {
+			invalid["endDate"] = "must be after the start date"
+		} else if changes.StartDate != nil {
+			invalid["startDate"] = "must be before the end date"
+		}
+	}
+}
+
+// Pick the owner of a new exhibition, the caller unless an admin names someone else
+func exhibitionOwner(ctx context.Context, ownerId string, invalid map[string]string) (string, error) {
+	identity, err := auth.FromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if ownerId == "" || ownerId == identity.UserId {
+		return identity.UserId, nil
+	}
+
+	if !identity.HasAny(auth.RoleAdmin) {
+		return "", auth.ErrForbidden
+	}
+
+	if _, err := stores.Users.ByID(ctx, ownerId); err == store.ErrNotFound {
+		invalid["ownerId"] = "doesn't exist"
+	} else if err != nil {
+		return "", err
+	}
+
+	return ownerId, nil
+}
+
+// Read the filter argument, invalid collects the problems with it
+func exhibitionFilterArg(params graphql.ResolveParams, invalid map[string]string) store.ExhibitionFilter {
+	var filter store.ExhibitionFilter
+
+	args, _ := params.Args["filter"].(map[string]interface{})
+
+	filter.OwnerId, _ = args["ownerId"].(string)
+	filter.StartsAfter, _ = args["startsAfter"].(time.Time)
+	filter.StartsBefore, _ = args["startsBefore"].(time.Time)
+	filter.Timing, _ = args["timing"].(store.Timing)
+
+	statuses, _ := args["status"].([]interface{})
+	for _, status := range statuses {
+		filter.Statuses = append(filter.Statuses, status.(store.ExhibitionStatus))
+	}
+
+	if len(filter.Statuses) == 0 {
+		filter.Statuses = publicStatuses
+	}
+
+	if filter.OwnerId != "" {
+		if _, err := strconv.Atoi(filter.OwnerId); err != nil {
+			invalid["filter.ownerId"] = "is not a valid id"
+		}
+	}
+
+	if !filter.StartsAfter.IsZero() && !filter.StartsBefore.IsZero() && filter.StartsBefore.Before(filter.StartsAfter) {
+		invalid["filter.startsBefore"] = "must not be before startsAfter"
+	}
+
+	return filter
+}
+
+func listsDrafts(filter store.ExhibitionFilter) bool {
+	for _, status := range filter.Statuses {
+		if status == store.StatusDraft {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve a connection of the exhibitions matching the filter and search query
+func exhibitionConnection(params graphql.ResolveParams, query string) (interface{}, error) {
+	invalid := map[string]string{}
+
+	page := pageArgs(params, invalid)
+	filter := exhibitionFilterArg(params, invalid)
+	filter.Query = query
+
+	sort, _ := params.Args["sort"].(store.ExhibitionSort)
+	if sort == store.Relevance && query == "" {
+		invalid["sort"] = "RELEVANCE is only available to searches"
+	}
+
+	if len(invalid) > 0 {
+		return nil, apperr.Validation(invalid)
+	}
+
+	if listsDrafts(filter) {
+		identity, err := auth.FromContext(params.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		if !identity.Allows(auth.ScopeExhibitionsRead) {
+			return nil, auth.ErrMissingScope
+		}
+
+		if !identity.HasAny(auth.RoleAdmin) {
+			filter.DraftsOf = identity.UserId
+		}
+	}
+
+	exhibitions, hasNext, err := stores.Exhibitions.List(params.Context, filter, sort, page)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := newConnection(page, hasNext, func(ctx context.Context) (int, error) {
+		return stores.Exhibitions.Count(ctx, filter)
+	})
+	for _, exhibition := range exhibitions {
+		conn.add(exhibition, exhibition.CursorBy(sort))
+	}
+
+	return conn, nil
+}
+
+// Whether the caller may change the exhibition and see it while it's a draft
+func canManage(ctx context.Context, exhibition *store.Exhibition) bool {
+	identity, err := auth.FromContext(ctx)
+	if err != nil {
+		return false
+	}
+
+	return identity.UserId == exhibition.OwnerId || identity.HasAny(auth.RoleAdmin)
+}
+
+// Drafts are only visible to those who may manage them, through a token granting exhibitions:read
+func canSeeDraft(ctx context.Context, exhibition *store.Exhibition) bool {
+	identity, err := auth.FromContext(ctx)
+	if err != nil {
+		return false
+	}
+
+	return identity.Allows(auth.ScopeExhibitionsRead) && canManage(ctx, exhibition)
+}
+
+// Load an exhibition the caller is about to change, only its owner and admins may
+func manageableExhibition(ctx context.Context, exhibitionId string) (*store.Exhibition, error) {
+	exhibition, err := stores.Exhibitions.ByID(ctx, exhibitionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canManage(ctx, exhibition) {
+		return nil, auth.ErrForbidden
+	}
+
+	return exhibition, nil
+}
+
+// Announce an exhibition that became public, a failure doesn't fail the mutation
+func publishCreated(ctx context.Context, exhibition *store.Exhibition) {
+	if err := events.PublishExhibitionCreated(exhibition); err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Failed to publish exhibition event")
+	}
+}
+
+// An owner that no longer exists resolves to null
+func ownerOrNil(user *store.User, err error) (interface{}, error) {
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
 func readExhibitionSchema() *graphql.Field {
 	return &graphql.Field{
 		Type: exhibitionType,
@@ -90,163 +334,250 @@ func readExhibitionSchema() *graphql.Field {
 			id, ok := params.Args["id"].(string)
 
 			if !ok {
-				return nil, errors.New("ID is required")
-			}
-
-			query := fmt.Sprintf(`
-				select
-					exhibition_id,
-					name,
-					description,
-					start_date,
-					created_date,
-					owner_id
-				from exhibitions ex
-				where ex.exhibition_id = %v;
-			`, id)
-
-			rows, err := connection.DB.Query(query)
+				return nil, apperr.Validation(map[string]string{"id": "is required"})
+			}
+
+			exhibition, err := stores.Exhibitions.ByID(params.Context, id)
+			if err == store.ErrNotFound {
+				return nil, nil
+			}
+
 			if err != nil {
 				return nil, err
 			}
 
-			exhibition := &Exhibition{}
-
-			for rows.Next() {
-				err = rows.Scan(
-					&exhibition.ExhibitionId,
-					&exhibition.Name,
-					&exhibition.Description,
-					&exhibition.StartDate,
-					&exhibition.CreatedDate,
-					&exhibition.OwnerId,
-				)
-				if err != nil {
-					return nil, err
-				}
+			if exhibition.Status == store.StatusDraft && !canSeeDraft(params.Context, exhibition) {
+				return nil, nil
 			}
 
-			decodedStr, _ := hex.DecodeString(exhibition.Description)
-			exhibition.Description = string(decodedStr)
 			return exhibition, nil
 		},
 	}
 }
 
 func readExhibitionsSchema() *graphql.Field {
+	args := connectionArgs()
+	args["filter"] = &graphql.ArgumentConfig{Type: exhibitionFilterType}
+	args["sort"] = &graphql.ArgumentConfig{Type: exhibitionSortType, DefaultValue: store.Newest}
+
 	return &graphql.Field{
-		Type: graphql.NewList(exhibitionType),
+		Type: exhibitionConnectionType,
+		Args: args,
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			return exhibitionConnection(params, "")
+		},
+	}
+}
+
+func readSearchExhibitionsSchema() *graphql.Field {
+	args := connectionArgs()
+	args["query"] = &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}
+	args["filter"] = &graphql.ArgumentConfig{Type: exhibitionFilterType}
+	args["sort"] = &graphql.ArgumentConfig{Type: exhibitionSortType, DefaultValue: store.Relevance}
+
+	return &graphql.Field{
+		Type:        exhibitionConnectionType,
+		Description: "Full-text search over the name and description of exhibitions",
+		Args:        args,
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			query, _ := params.Args["query"].(string)
+			query = strings.TrimSpace(query)
+
+			if query == "" {
+				return nil, apperr.Validation(map[string]string{"query": "is required"})
+			}
+
+			return exhibitionConnection(params, query)
+		},
+	}
+}
+
+func readCreateExhibitionSchema() *graphql.Field {
+	return &graphql.Field{
+		Type: exhibitionType,
 		Args: graphql.FieldConfigArgument{
-			"limit":  &graphql.ArgumentConfig{Type: graphql.Int},
-			"offset": &graphql.ArgumentConfig{Type: graphql.Int},
+			"name":        &graphql.ArgumentConfig{Type: graphql.String},
+			"description": &graphql.ArgumentConfig{Type: graphql.String},
+			"startDate":   &graphql.ArgumentConfig{Type: dateTimeType},
+			"endDate":     &graphql.ArgumentConfig{Type: dateTimeType},
+			"ownerId": &graphql.ArgumentConfig{
+				Type:        graphql.String,
+				Description: "Admins may create exhibitions for someone else, the caller owns it otherwise",
+			},
+			"status": &graphql.ArgumentConfig{
+				Type:         exhibitionStatusType,
+				Description:  "DRAFT or SCHEDULED",
+				DefaultValue: store.StatusScheduled,
+			},
 		},
 		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-			limit, ok := params.Args["limit"].(int)
-			offset, _ := params.Args["offset"].(int)
-
-			queryString := `
-				select
-					exhibition_id,
-					name,
-					description,
-					start_date,
-					created_date,
-					owner_id
-				from exhibitions ex
-				order by created_date desc
-			`
-
-			query := fmt.Sprintf(queryString+`
-				limit %v offset %v;
-			`, limit, offset)
+			name, _ := params.Args["name"].(string)
+			description, _ := params.Args["description"].(string)
+			startDate, hasStart := params.Args["startDate"].(time.Time)
+			ownerId, _ := params.Args["ownerId"].(string)
+			status, _ := params.Args["status"].(store.ExhibitionStatus)
 
-			if !ok {
-				query = queryString
+			invalid := map[string]string{}
+
+			if status != store.StatusDraft && status != store.StatusScheduled {
+				invalid["status"] = "must be DRAFT or SCHEDULED"
+			}
+
+			var endDate *time.Time
+			if end, ok := params.Args["endDate"].(time.Time); ok {
+				endDate = &end
+			}
+
+			validateExhibition(store.ExhibitionChanges{
+				Name:        &name,
+				Description: &description,
+				StartDate:   &startDate,
+				EndDate:     endDate,
+			}, nil, invalid)
+
+			if !hasStart {
+				invalid["startDate"] = "is required"
 			}
 
-			rows, err := connection.DB.Query(query)
+			ownerId, err := exhibitionOwner(params.Context, ownerId, invalid)
 			if err != nil {
 				return nil, err
 			}
 
-			var exhibitions []*Exhibition
-
-			for rows.Next() {
-				var exhibition Exhibition
+			if len(invalid) > 0 {
+				return nil, apperr.Validation(invalid)
+			}
 
-				err = rows.Scan(
-					&exhibition.ExhibitionId,
-					&exhibition.Name,
-					&exhibition.Description,
-					&exhibition.StartDate,
-					&exhibition.CreatedDate,
-					&exhibition.OwnerId,
-				)
-				if err != nil {
-					return nil, err
-				}
+			exhibition, err := stores.Exhibitions.Create(params.Context, store.NewExhibition{
+				Name:        strings.TrimSpace(name),
+				Description: description,
+				StartDate:   startDate,
+				EndDate:     endDate,
+				OwnerId:     ownerId,
+				Status:      status,
+			})
+			if err != nil {
+				return nil, err
+			}
 
-				decodedStr, _ := hex.DecodeString(exhibition.Description)
-				exhibition.Description = string(decodedStr)
-				exhibitions = append(exhibitions, &exhibition)
+			if exhibition.Status != store.StatusDraft {
+				publishCreated(params.Context, exhibition)
 			}
 
-			return exhibitions, nil
+			return exhibition, nil
 		},
 	}
 }
 
-func readCreateExhibitionSchema() *graphql.Field {
+func readUpdateExhibitionSchema() *graphql.Field {
 	return &graphql.Field{
-		Type: graphql.NewObject(graphql.ObjectConfig{
-			Name: "CreateExhibitionResponse",
-			Fields: graphql.Fields{
-				"status": &graphql.Field{Type: graphql.String},
-			},
-		}),
+		Type: exhibitionType,
 		Args: graphql.FieldConfigArgument{
+			"id":          &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 			"name":        &graphql.ArgumentConfig{Type: graphql.String},
 			"description": &graphql.ArgumentConfig{Type: graphql.String},
-			"startDate":   &graphql.ArgumentConfig{Type: graphql.String},
-			"ownerId":     &graphql.ArgumentConfig{Type: graphql.String},
+			"startDate":   &graphql.ArgumentConfig{Type: dateTimeType},
+			"endDate":     &graphql.ArgumentConfig{Type: dateTimeType},
+			"clearEndDate": &graphql.ArgumentConfig{
+				Type:        graphql.Boolean,
+				Description: "Remove the end date, leaving the exhibition open ended",
+			},
 		},
 		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-			req := params.Context.Value("request").(*http.Request)
-			_, err := utils.TokenValid(req)
+			id, _ := params.Args["id"].(string)
+
+			var changes store.ExhibitionChanges
+			changes.ClearEndDate, _ = params.Args["clearEndDate"].(bool)
+
+			if name, ok := params.Args["name"].(string); ok {
+				name = strings.TrimSpace(name)
+				changes.Name = &name
+			}
+
+			if description, ok := params.Args["description"].(string); ok {
+				changes.Description = &description
+			}
+
+			if startDate, ok := params.Args["startDate"].(time.Time); ok {
+				changes.StartDate = &startDate
+			}
+
+			if endDate, ok := params.Args["endDate"].(time.Time); ok {
+				changes.EndDate = &endDate
+			}
+
+			exhibition, err := manageableExhibition(params.Context, id)
 			if err != nil {
 				return nil, err
 			}
 
-			name, _ := params.Args["name"].(string)
-			description, _ := params.Args["description"].(string)
-			startDate, _ := params.Args["startDate"].(string)
-			ownerId, _ := params.Args["ownerId"].(string)
-			description = strings.Replace(description, "'", "''", -1)
+			if exhibition.Status == store.StatusArchived {
+				return nil, apperr.New(apperr.FailedPrecondition, "archived exhibitions can't be edited")
+			}
+
+			invalid := map[string]string{}
+			if validateExhibition(changes, exhibition, invalid); len(invalid) > 0 {
+				return nil, apperr.Validation(invalid)
+			}
 
-			query := fmt.Sprintf(`
-				insert into exhibitions (name, description, start_date, owner_id)
-				values ('%v', '%v', '%v', '%v');
-			`, name, hex.EncodeToString([]byte(description)), startDate, ownerId)
+			return stores.Exhibitions.Update(params.Context, id, changes)
+		},
+	}
+}
+
+func readTransitionExhibitionSchema() *graphql.Field {
+	return &graphql.Field{
+		Type:        exhibitionType,
+		Description: "Move the exhibition along draft, scheduled, live, ended and archived",
+		Args: graphql.FieldConfigArgument{
+			"id":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			"status": &graphql.ArgumentConfig{Type: graphql.NewNonNull(exhibitionStatusType)},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			id, _ := params.Args["id"].(string)
+			status, _ := params.Args["status"].(store.ExhibitionStatus)
 
-			stmt, err := connection.DB.Prepare(query)
+			exhibition, err := manageableExhibition(params.Context, id)
 			if err != nil {
 				return nil, err
 			}
 
-			defer stmt.Close()
+			if !exhibition.Status.CanBecome(status) {
+				return nil, apperr.New(
+					apperr.FailedPrecondition,
+					"a "+string(exhibition.Status)+" exhibition can't become "+string(status),
+				)
+			}
+
+			updated, err := stores.Exhibitions.SetStatus(params.Context, id, exhibition.Status, status)
+			if err != nil {
+				return nil, err
+			}
 
-			_, err = stmt.Exec()
-			res := struct {
-				Status string `json:"status"`
-			}{
-				Status: "bad",
+			if exhibition.Status == store.StatusDraft && updated.Status == store.StatusScheduled {
+				publishCreated(params.Context, updated)
 			}
 
-			if err == nil {
-				res.Status = "ok"
+			return updated, nil
+		},
+	}
+}
+
+func readDeleteExhibitionSchema() *graphql.Field {
+	return &graphql.Field{
+		Type:        exhibitionType,
+		Description: "Hide the exhibition and return it as it was last seen",
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			id, _ := params.Args["id"].(string)
+
+			if _, err := manageableExhibition(params.Context, id); err != nil {
+				return nil, err
 			}
 
-			return res, err
+			return stores.Exhibitions.Delete(params.Context, id)
 		},
 	}
 }
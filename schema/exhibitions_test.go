@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"fmt"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/store"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateExhibitionDates(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Now().Add(day)
+	end := time.Now().Add(2 * day)
+	later := time.Now().Add(30 * day)
+	earlier := time.Now().Add(12 * time.Hour)
+
+	current := &store.Exhibition{StartDate: start, EndDate: &end}
+
+	tests := []struct {
+		name    string
+		changes store.ExhibitionChanges
+		current *store.Exhibition
+		invalid string
+	}{
+		{"start moved after the stored end", store.ExhibitionChanges{StartDate: &later}, current, "startDate"},
+		{"start moved before the stored end", store.ExhibitionChanges{StartDate: &earlier}, current, ""},
+		{"end moved before the stored start", store.ExhibitionChanges{EndDate: &earlier}, current, "endDate"},
+		{"both moved together", store.ExhibitionChanges{StartDate: &later, EndDate: &later}, current, "endDate"},
+		{"end cleared while start moves later", store.ExhibitionChanges{StartDate: &later, ClearEndDate: true}, current, ""},
+		{"end cleared and set at once", store.ExhibitionChanges{EndDate: &later, ClearEndDate: true}, current, "clearEndDate"},
+		{"new exhibition ending before it starts", store.ExhibitionChanges{StartDate: &end, EndDate: &start}, nil, "endDate"},
+		{"open ended exhibition moved", store.ExhibitionChanges{StartDate: &later}, &store.Exhibition{StartDate: start}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			invalid := map[string]string{}
+			validateExhibition(test.changes, test.current, invalid)
+
+			if test.invalid == "" && len(invalid) > 0 {
+				t.Fatalf("expected no problems, got %v", invalid)
+			}
+
+			if test.invalid != "" {
+				if _, ok := invalid[test.invalid]; !ok {
+					t.Fatalf("expected a problem with %s, got %v", test.invalid, invalid)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteExhibitionReturnsIt(t *testing.T) {
+	producer := &auth.Identity{UserId: "2", Roles: []auth.Role{auth.RoleProducer}}
+
+	created := executeAs(t, producer, strings.Replace(createDraft, "{ name }", "{ exhibitionId name }", 1))
+	if len(created.Errors) > 0 {
+		t.Fatal(created.Errors)
+	}
+	exhibition := created.Data.(map[string]interface{})["createExhibition"].(map[string]interface{})
+
+	deleteIt := fmt.Sprintf(`mutation { deleteExhibition(id: %q) { exhibitionId name } }`, exhibition["exhibitionId"])
+
+	res := executeAs(t, producer, deleteIt)
+	if len(res.Errors) > 0 {
+		t.Fatal(res.Errors)
+	}
+
+	deleted := res.Data.(map[string]interface{})["deleteExhibition"].(map[string]interface{})
+	if deleted["exhibitionId"] != exhibition["exhibitionId"] || deleted["name"] != exhibition["name"] {
+		t.Fatalf("got %v, want the deleted exhibition %v", deleted, exhibition)
+	}
+
+	if code := errorCode(t, executeAs(t, producer, deleteIt)); code != "NOT_FOUND" {
+		t.Fatalf("deleting it again got code %q, want NOT_FOUND", code)
+	}
+}
@@ -0,0 +1,38 @@
+package schema
+
+import (
+	"context"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// extension implements graphql.Extension without doing anything, embed it and override the hooks needed
+type extension struct{}
+
+func (extension) Init(ctx context.Context, _ *graphql.Params) context.Context {
+	return ctx
+}
+
+func (extension) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	return ctx, func(error) {}
+}
+
+func (extension) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	return ctx, func([]gqlerrors.FormattedError) {}
+}
+
+func (extension) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	return ctx, func(*graphql.Result) {}
+}
+
+func (extension) ResolveFieldDidStart(ctx context.Context, _ *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	return ctx, func(interface{}, error) {}
+}
+
+func (extension) HasResult() bool {
+	return false
+}
+
+func (extension) GetResult(context.Context) interface{} {
+	return nil
+}
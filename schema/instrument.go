@@ -0,0 +1,23 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"strings"
+)
+
+// Instrument wraps every field with its own resolver to trace it and to turn its errors into ones
+// clients may see. Fields read straight from their parent are skipped
+func Instrument(s graphql.Schema) {
+	for typeName, t := range s.TypeMap() {
+		object, ok := t.(*graphql.Object)
+		if !ok || strings.HasPrefix(typeName, "__") {
+			continue
+		}
+
+		for _, field := range object.Fields() {
+			if field.Resolve != nil {
+				field.Resolve = reportErrors(traceField(typeName, field.Resolve))
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package schema
+
+import (
+	"context"
+	"github.com/graphql-go/graphql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+var (
+	fieldDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphql_field_duration_seconds",
+		Help:    "Time spent resolving a GraphQL field.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"type", "field"})
+
+	fieldErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_field_errors_total",
+		Help: "GraphQL fields whose resolver returned an error.",
+	}, []string{"type", "field"})
+)
+
+// Record the latency and errors of every resolved field
+type metricsExtension struct {
+	extension
+}
+
+func (metricsExtension) Name() string {
+	return "metrics"
+}
+
+func (metricsExtension) ResolveFieldDidStart(ctx context.Context, info *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	started := time.Now()
+	labels := prometheus.Labels{"type": info.ParentType.Name(), "field": info.FieldName}
+
+	return ctx, func(_ interface{}, err error) {
+		fieldDuration.With(labels).Observe(time.Since(started).Seconds())
+		if err != nil {
+			fieldErrors.With(labels).Inc()
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package schema
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/auth"
+	"testing"
+)
+
+func TestAddToProducerReturnsTheUser(t *testing.T) {
+	admin := &auth.Identity{UserId: "1", Roles: []auth.Role{auth.RoleAdmin}}
+
+	res := executeAs(t, admin, `mutation { addToProducer(userId: "4") { userId } }`)
+	if len(res.Errors) > 0 {
+		t.Fatal(res.Errors)
+	}
+
+	user := res.Data.(map[string]interface{})["addToProducer"].(map[string]interface{})
+	if user["userId"] != "4" {
+		t.Fatalf("got %v, want user 4", user)
+	}
+
+	roles, _ := testFakes.Roles.Of(context.Background(), "4")
+	if len(roles) != 1 || roles[0] != "producer" {
+		t.Fatalf("user 4 has the roles %v", roles)
+	}
+
+	if code := errorCode(t, executeAs(t, admin, `mutation { addToAdmins(userId: "404") { userId } }`)); code != "NOT_FOUND" {
+		t.Fatalf("an unknown user got code %q, want NOT_FOUND", code)
+	}
+}
@@ -0,0 +1,71 @@
+package schema
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Arguments that fail to parse are rejected by graphql-go with a message naming the argument and the expected type
+var dateTimeType = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "DateTime",
+	Description: "A point in time in RFC 3339 format with a time zone offset, e.g. 2021-06-01T18:30:00+02:00",
+	Serialize: func(value interface{}) interface{} {
+		switch value := value.(type) {
+		case time.Time:
+			return value.Format(time.RFC3339Nano)
+		case *time.Time:
+			if value == nil {
+				return nil
+			}
+			return value.Format(time.RFC3339Nano)
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		return parseTime(value, time.RFC3339Nano)
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		if value, ok := valueAST.(*ast.StringValue); ok {
+			return parseTime(value.Value, time.RFC3339Nano)
+		}
+		return nil
+	},
+})
+
+var dateType = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Date",
+	Description: "A calendar date in YYYY-MM-DD format",
+	Serialize: func(value interface{}) interface{} {
+		if value, ok := value.(time.Time); ok {
+			return value.Format(dateLayout)
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		return parseTime(value, dateLayout)
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		if value, ok := valueAST.(*ast.StringValue); ok {
+			return parseTime(value.Value, dateLayout)
+		}
+		return nil
+	},
+})
+
+// Parse a string value with the layout, nil tells graphql-go the value is invalid
+func parseTime(value interface{}, layout string) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return nil
+	}
+
+	return t
+}
@@ -1,16 +1,21 @@
 package schema
 
 import (
-	"github.com/gloompi/tantora-back/app/dbConnection"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/store"
 	"github.com/graphql-go/graphql"
 )
 
-var connection = dbConnection.ReadConnection()
+var stores *store.Store
+
+func ReadSchema(s *store.Store) *graphql.SchemaConfig {
+	stores = s
 
-func ReadSchema() *graphql.SchemaConfig {
 	schemaConfig := graphql.SchemaConfig{
-		Query:    rootQuery(),
-		Mutation: rootMutation(),
+		Query:        rootQuery(),
+		Mutation:     rootMutation(),
+		Subscription: rootSubscription(),
+		Extensions:   []graphql.Extension{metricsExtension{}},
 	}
 
 	return &schemaConfig
@@ -18,15 +23,19 @@ func ReadSchema() *graphql.SchemaConfig {
 
 func rootQuery() *graphql.Object {
 	fields := graphql.Fields{
-		"me":          readMeSchema(),
-		"users":       readUsersSchema(),
-		"producers":   readProducersSchema(),
-		"audience":    readAudienceSchema(),
-		"exhibition":  readExhibitionSchema(),
-		"exhibitions": readExhibitionsSchema(),
-		"loginUser":   readLoginUserSchema(),
-		"admins":      readAdminsSchema(),
-		"logout":      readLogoutSchema(),
+		"me":                authorize(readMeSchema()),
+		"users":             authorize(readUsersSchema(), auth.RoleAdmin),
+		"producers":         authorize(readProducersSchema(), auth.RoleAdmin),
+		"audience":          authorize(readAudienceSchema(), auth.RoleAdmin, auth.RoleProducer),
+		"exhibition":        readExhibitionSchema(),
+		"exhibitions":       readExhibitionsSchema(),
+		"searchExhibitions": readSearchExhibitionsSchema(),
+		"loginUser":         readLoginUserSchema(),
+		"admins":            authorize(readAdminsSchema(), auth.RoleAdmin),
+		"logout":            authorize(readLogoutSchema()),
+		"myApiKeys":         authorize(readMyAPIKeysSchema()),
+		"mySessions":        authorize(readMySessionsSchema()),
+		"userSessions":      authorize(readUserSessionsSchema(), auth.RoleAdmin),
 	}
 
 	return graphql.NewObject(graphql.ObjectConfig{Name: "RootQuery", Fields: fields})
@@ -34,11 +43,20 @@ func rootQuery() *graphql.Object {
 
 func rootMutation() *graphql.Object {
 	fields := graphql.Fields{
-		"createUser":       readCreateUserSchema(),
-		"refreshToken":     readRefreshTokenSchema(),
-		"createExhibition": readCreateExhibitionSchema(),
-		"addToAdmins":      readAddToAdminSchema(),
-		"addToProducer":    readAddToProducerSchema(),
+		"createUser":            readCreateUserSchema(),
+		"refreshToken":          readRefreshTokenSchema(),
+		"createExhibition":      authorize(readCreateExhibitionSchema(), auth.RoleAdmin, auth.RoleProducer),
+		"updateExhibition":      authorize(readUpdateExhibitionSchema()),
+		"transitionExhibition":  authorize(readTransitionExhibitionSchema()),
+		"deleteExhibition":      authorize(readDeleteExhibitionSchema()),
+		"addToAdmins":           authorize(readAddToAdminSchema(), auth.RoleAdmin),
+		"addToProducer":         authorize(readAddToProducerSchema(), auth.RoleAdmin),
+		"createApiKey":          authorize(readCreateAPIKeySchema()),
+		"revokeApiKey":          authorize(readRevokeAPIKeySchema()),
+		"revokeSession":         authorize(readRevokeSessionSchema()),
+		"revokeAllSessions":     authorize(readRevokeAllSessionsSchema()),
+		"revokeUserSession":     authorize(readRevokeUserSessionSchema(), auth.RoleAdmin),
+		"revokeAllUserSessions": authorize(readRevokeAllUserSessionsSchema(), auth.RoleAdmin),
 	}
 
 	return graphql.NewObject(graphql.ObjectConfig{Name: "RootMutation", Fields: fields})
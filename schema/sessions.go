@@ -0,0 +1,228 @@
+package schema
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/logging"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/gloompi/tantora-back/app/utils"
+	"github.com/graphql-go/graphql"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+const (
+	maxDeviceLength    = 100
+	maxUserAgentLength = 256
+)
+
+var errNoSession = apperr.New(apperr.NotFound, "no such session")
+
+var sessionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Session",
+	Fields: graphql.Fields{
+		"sessionId":   &graphql.Field{Type: graphql.String},
+		"device":      &graphql.Field{Type: graphql.String},
+		"userAgent":   &graphql.Field{Type: graphql.String},
+		"ip":          &graphql.Field{Type: graphql.String},
+		"createdAt":   &graphql.Field{Type: dateTimeType},
+		"refreshedAt": &graphql.Field{Type: dateTimeType},
+		"current": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Whether the request was made within this session",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				session, _ := params.Source.(*utils.Session)
+				identity, err := auth.FromContext(params.Context)
+				if err != nil || session == nil {
+					return false, nil
+				}
+
+				return identity.SessionId == session.SessionId, nil
+			},
+		},
+	},
+})
+
+var revokeSessionsResponseType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RevokeSessionsResponse",
+	Fields: graphql.Fields{
+		"revoked": &graphql.Field{Type: graphql.Int},
+	},
+})
+
+// Describe the client of the request for the session it opens
+func sessionMeta(ctx context.Context, device string) utils.SessionMeta {
+	meta := utils.SessionMeta{Device: device}
+
+	req, ok := ctx.Value("request").(*http.Request)
+	if !ok {
+		return meta
+	}
+
+	meta.UserAgent = req.UserAgent()
+	if len(meta.UserAgent) > maxUserAgentLength {
+		meta.UserAgent = meta.UserAgent[:maxUserAgentLength]
+	}
+
+	meta.IP = utils.ClientIP(req)
+
+	return meta
+}
+
+// Record that an admin ended the sessions of another user
+func auditSessionRevocation(ctx context.Context, userId, sessionId string, revoked int) {
+	identity, err := auth.FromContext(ctx)
+	if err != nil || identity.UserId == userId {
+		return
+	}
+
+	err = stores.Audit.Record(ctx, store.AuditEvent{
+		ActorId: identity.UserId,
+		Action:  "session.revoked",
+		Target:  userId,
+		Details: map[string]interface{}{"sessionId": sessionId, "revoked": revoked},
+	})
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Failed to record audit event")
+	}
+}
+
+// Log and audit a replayed refresh token, it was most likely stolen
+func reportRefreshTokenReuse(ctx context.Context, userId, sessionId string) {
+	meta := sessionMeta(ctx, "")
+
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"security_event": "refresh_token_reused",
+		"target_user_id": userId,
+		"session_id":     sessionId,
+		"ip":             meta.IP,
+		"user_agent":     meta.UserAgent,
+	}).Warn("A rotated refresh token was used again, its session was revoked")
+
+	err := stores.Audit.Record(ctx, store.AuditEvent{
+		Action:  "security.refresh_token_reused",
+		Target:  userId,
+		Details: map[string]interface{}{"sessionId": sessionId, "ip": meta.IP, "userAgent": meta.UserAgent},
+	})
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("Failed to record audit event")
+	}
+}
+
+func revokeSession(ctx context.Context, userId, sessionId string) (interface{}, error) {
+	ok, err := utils.RevokeSession(userId, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, errNoSession
+	}
+
+	auditSessionRevocation(ctx, userId, sessionId, 1)
+
+	return map[string]interface{}{"revoked": 1}, nil
+}
+
+func revokeAllSessions(ctx context.Context, userId string) (interface{}, error) {
+	revoked, err := utils.RevokeAllSessions(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	auditSessionRevocation(ctx, userId, "", revoked)
+
+	return map[string]interface{}{"revoked": revoked}, nil
+}
+
+func readMySessionsSchema() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(sessionType),
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			identity, err := auth.FromContext(params.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			return utils.Sessions(identity.UserId)
+		},
+	}
+}
+
+func readUserSessionsSchema() *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(sessionType),
+		Args: graphql.FieldConfigArgument{
+			"userId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			userId, _ := params.Args["userId"].(string)
+
+			return utils.Sessions(userId)
+		},
+	}
+}
+
+func readRevokeSessionSchema() *graphql.Field {
+	return &graphql.Field{
+		Type: revokeSessionsResponseType,
+		Args: graphql.FieldConfigArgument{
+			"sessionId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			identity, err := auth.FromContext(params.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			sessionId, _ := params.Args["sessionId"].(string)
+
+			return revokeSession(params.Context, identity.UserId, sessionId)
+		},
+	}
+}
+
+func readRevokeAllSessionsSchema() *graphql.Field {
+	return &graphql.Field{
+		Type: revokeSessionsResponseType,
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			identity, err := auth.FromContext(params.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			return revokeAllSessions(params.Context, identity.UserId)
+		},
+	}
+}
+
+func readRevokeUserSessionSchema() *graphql.Field {
+	return &graphql.Field{
+		Type: revokeSessionsResponseType,
+		Args: graphql.FieldConfigArgument{
+			"userId":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			"sessionId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			userId, _ := params.Args["userId"].(string)
+			sessionId, _ := params.Args["sessionId"].(string)
+
+			return revokeSession(params.Context, userId, sessionId)
+		},
+	}
+}
+
+func readRevokeAllUserSessionsSchema() *graphql.Field {
+	return &graphql.Field{
+		Type: revokeSessionsResponseType,
+		Args: graphql.FieldConfigArgument{
+			"userId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			userId, _ := params.Args["userId"].(string)
+
+			return revokeAllSessions(params.Context, userId)
+		},
+	}
+}
@@ -0,0 +1,174 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/events"
+	"github.com/gloompi/tantora-back/app/loader"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+var messageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Message",
+	Fields: graphql.Fields{
+		"senderId":    &graphql.Field{Type: graphql.String},
+		"receiverId":  &graphql.Field{Type: graphql.String},
+		"content":     &graphql.Field{Type: graphql.String},
+		"createdDate": &graphql.Field{Type: dateTimeType},
+	},
+})
+
+// Subscription fields resolve to the event found in the root object under their own name
+func rootSubscription() *graphql.Object {
+	fields := graphql.Fields{
+		"messageReceived":   authorize(&graphql.Field{Type: messageType}),
+		"exhibitionCreated": authorize(&graphql.Field{Type: exhibitionType}),
+		"exhibitionStarted": authorize(&graphql.Field{Type: exhibitionType}),
+	}
+
+	return graphql.NewObject(graphql.ObjectConfig{Name: "RootSubscription", Fields: fields})
+}
+
+// An event source calls emit for every event until ctx is done
+type eventSource func(ctx context.Context, emit func(event interface{}) error) error
+
+// Check the subscriber before listening, the way authorize checks the caller of the field
+func subscriber(ctx context.Context, field string) (*auth.Identity, error) {
+	identity, err := auth.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !identity.Allows(fieldScopes[field]) {
+		return nil, auth.ErrMissingScope
+	}
+
+	return identity, nil
+}
+
+var eventSources = map[string]eventSource{
+	"messageReceived": func(ctx context.Context, emit func(interface{}) error) error {
+		identity, err := subscriber(ctx, "messageReceived")
+		if err != nil {
+			return err
+		}
+
+		return events.SubscribeMessages(ctx, identity.UserId, func(m *store.Message) error {
+			return emit(m)
+		})
+	},
+	"exhibitionCreated": func(ctx context.Context, emit func(interface{}) error) error {
+		if _, err := subscriber(ctx, "exhibitionCreated"); err != nil {
+			return err
+		}
+
+		return events.SubscribeExhibitionCreated(ctx, func(e *store.Exhibition) error {
+			return emit(e)
+		})
+	},
+	"exhibitionStarted": func(ctx context.Context, emit func(interface{}) error) error {
+		if _, err := subscriber(ctx, "exhibitionStarted"); err != nil {
+			return err
+		}
+
+		return events.SubscribeExhibitionStarted(ctx, func(e *store.Exhibition) error {
+			return emit(e)
+		})
+	},
+}
+
+// RequestError is returned when a subscription request is invalid and never started
+type RequestError struct {
+	Errors []gqlerrors.FormattedError
+}
+
+func (e *RequestError) Error() string {
+	if len(e.Errors) == 0 {
+		return "invalid subscription request"
+	}
+
+	return e.Errors[0].Message
+}
+
+func requestError(message string) *RequestError {
+	return &RequestError{[]gqlerrors.FormattedError{gqlerrors.NewFormattedError(message)}}
+}
+
+// Find the root field of the subscription operation
+func subscriptionField(doc *ast.Document, operationName string) (string, error) {
+	var operation *ast.OperationDefinition
+
+	for _, definition := range doc.Definitions {
+		op, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			if operation != nil {
+				return "", requestError("must provide operation name if query contains multiple operations")
+			}
+			operation = op
+		}
+	}
+
+	if operation == nil {
+		return "", requestError("unknown operation")
+	}
+
+	if operation.Operation != ast.OperationTypeSubscription {
+		return "", requestError("only subscription operations are supported")
+	}
+
+	selections := operation.SelectionSet.Selections
+	if len(selections) != 1 {
+		return "", requestError("a subscription must select exactly one root field")
+	}
+
+	field, ok := selections[0].(*ast.Field)
+	if !ok {
+		return "", requestError("a subscription must select a root field directly")
+	}
+
+	return field.Name.Value, nil
+}
+
+// Subscribe executes the subscription once per event and hands every result to send.
+// It blocks until ctx is done, the event source fails or send returns an error.
+func Subscribe(ctx context.Context, p graphql.Params, send func(*graphql.Result) error) error {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(p.RequestString), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return &RequestError{gqlerrors.FormatErrors(err)}
+	}
+
+	validation := graphql.ValidateDocument(&p.Schema, doc, nil)
+	if !validation.IsValid {
+		return &RequestError{validation.Errors}
+	}
+
+	fieldName, err := subscriptionField(doc, p.OperationName)
+	if err != nil {
+		return err
+	}
+
+	subscribe, ok := eventSources[fieldName]
+	if !ok {
+		return errors.New("no event source for " + fieldName)
+	}
+
+	return subscribe(ctx, func(event interface{}) error {
+		// every event is resolved on its own, loaders cached for the whole connection would go stale
+		p.Context = loader.NewContext(ctx, loader.New(stores))
+		p.RootObject = map[string]interface{}{fieldName: event}
+
+		return send(graphql.Do(p))
+	})
+}
@@ -0,0 +1,41 @@
+package schema
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/graphql-go/graphql"
+	"testing"
+)
+
+func TestSubscriptionsRequireAnAllowedCaller(t *testing.T) {
+	// builds the shared schema
+	executeAs(t, nil, `{ __typename }`)
+
+	chatOnly := &auth.Identity{UserId: "3", Roles: []auth.Role{auth.RoleAudience}, Scopes: []auth.Scope{auth.ScopeChatRead}}
+
+	for _, field := range []string{"exhibitionCreated", "exhibitionStarted", "messageReceived"} {
+		for caller, identity := range map[string]*auth.Identity{"anonymous": nil, "chat only token": chatOnly} {
+			if field == "messageReceived" && identity != nil {
+				continue
+			}
+
+			want := apperr.Unauthenticated
+			if identity != nil {
+				want = apperr.Forbidden
+			}
+
+			err := Subscribe(auth.NewContext(context.Background(), identity, nil), graphql.Params{
+				Schema:        testSchema,
+				RequestString: `subscription { ` + field + ` { __typename } }`,
+			}, func(*graphql.Result) error {
+				t.Fatalf("%s as %s received an event", field, caller)
+				return nil
+			})
+
+			if code := apperr.From(err).Code; code != want {
+				t.Errorf("%s as %s: got %v, want %s", field, caller, err, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package schema
+
+import (
+	"github.com/gloompi/tantora-back/app/tracing"
+	"github.com/graphql-go/graphql"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Record a span for the field, the span context is handed to the resolver so the statements it runs
+// are nested under the field. A field resolved later through a thunk keeps its span open until the
+// thunk has run
+func traceField(typeName string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		ctx, span := tracing.Tracer().Start(params.Context, typeName+"."+params.Info.FieldName)
+		span.SetAttributes(
+			attribute.String("graphql.type", typeName),
+			attribute.String("graphql.field", params.Info.FieldName),
+		)
+
+		params.Context = ctx
+		res, err := resolve(params)
+		if thunk, ok := res.(func() (interface{}, error)); ok && err == nil {
+			return func() (interface{}, error) {
+				res, err := thunk()
+				tracing.End(span, err)
+
+				return res, err
+			}, nil
+		}
+		tracing.End(span, err)
+
+		return res, err
+	}
+}
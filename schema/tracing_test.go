@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"context"
+	"github.com/graphql-go/graphql"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestTraceFieldEndsThunkSpansWhenResolved(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	resolved := false
+	resolve := traceField("Query", func(params graphql.ResolveParams) (interface{}, error) {
+		return func() (interface{}, error) {
+			resolved = true
+			return "done", nil
+		}, nil
+	})
+
+	res, err := resolve(graphql.ResolveParams{Context: context.Background(), Info: graphql.ResolveInfo{FieldName: "users"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(recorder.Ended()); n != 0 {
+		t.Fatalf("%d spans ended before the thunk ran", n)
+	}
+
+	value, err := res.(func() (interface{}, error))()
+	if err != nil || value != "done" || !resolved {
+		t.Fatalf("the thunk resolved to %v, %v", value, err)
+	}
+
+	ended := recorder.Ended()
+	if len(ended) != 1 || ended[0].Name() != "Query.users" {
+		t.Fatalf("got the ended spans %v", ended)
+	}
+}
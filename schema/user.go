@@ -1,25 +1,16 @@
 package schema
 
 import (
-	"errors"
-	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/store"
 	"github.com/gloompi/tantora-back/app/utils"
 	"github.com/graphql-go/graphql"
-	"net/http"
-	"os"
+	"time"
 )
 
-type User struct {
-	UserId      string `json:"user_id"`
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	UserName    string `json:"user_name"`
-	Email       string `json:"email"`
-	Phone       string `json:"phone"`
-	DateOfBirth string `json:"date_of_birth"`
-	IsActive    bool   `json:"is_active"`
-}
+var errWrongCredentials = apperr.New(apperr.Unauthenticated, "wrong username or password")
 
 type Token struct {
 	AccessToken  string `json:"access_token"`
@@ -35,8 +26,9 @@ var userType = graphql.NewObject(graphql.ObjectConfig{
 		"userName":    &graphql.Field{Type: graphql.String},
 		"email":       &graphql.Field{Type: graphql.String},
 		"phone":       &graphql.Field{Type: graphql.String},
-		"dateOfBirth": &graphql.Field{Type: graphql.String},
+		"dateOfBirth": &graphql.Field{Type: dateType},
 		"isActive":    &graphql.Field{Type: graphql.Boolean},
+		"createdDate": &graphql.Field{Type: dateTimeType},
 	},
 })
 
@@ -52,104 +44,22 @@ func readMeSchema() *graphql.Field {
 	return &graphql.Field{
 		Type: userType,
 		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-			req := params.Context.Value("request").(*http.Request)
-			userId, err := utils.TokenValid(req)
-
-			if err != nil {
-				return nil, err
-			}
-
-			query := fmt.Sprintf(`
-				select
-					user_id,
-					user_name,
-					first_name,
-					last_name,
-					email,
-					phone,
-					date_of_birth,
-					is_active
-				from users u where u.user_id = '%v';
-			`, userId)
-
-			rows, err := connection.DB.Query(query)
+			identity, err := auth.FromContext(params.Context)
 			if err != nil {
 				return nil, err
 			}
 
-			var user User
-
-			for rows.Next() {
-				err = rows.Scan(
-					&user.UserId,
-					&user.UserName,
-					&user.FirstName,
-					&user.LastName,
-					&user.Email,
-					&user.Phone,
-					&user.DateOfBirth,
-					&user.IsActive,
-				)
-
-				if err != nil {
-					return nil, err
-				}
-			}
-
-			return user, nil
+			return stores.Users.ByID(params.Context, identity.UserId)
 		},
 	}
 }
 
 func readUsersSchema() *graphql.Field {
 	return &graphql.Field{
-		Type: graphql.NewList(userType),
+		Type: userConnectionType,
+		Args: connectionArgs(),
 		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-			req := params.Context.Value("request").(*http.Request)
-			_, err := utils.TokenValid(req)
-			if err != nil {
-				return nil, err
-			}
-
-			query := fmt.Sprintln(`
-				select
-					first_name,
-					last_name,
-					email,
-					date_of_birth,
-					is_active,
-					user_id,
-					phone,
-					user_name
-				from users;
-			`)
-			rows, err := connection.DB.Query(query)
-			if err != nil {
-				return nil, err
-			}
-
-			var users []*User
-
-			for rows.Next() {
-				var user User
-				err = rows.Scan(
-					&user.FirstName,
-					&user.LastName,
-					&user.Email,
-					&user.DateOfBirth,
-					&user.IsActive,
-					&user.UserId,
-					&user.Phone,
-					&user.UserName,
-				)
-				if err != nil {
-					return nil, err
-				}
-
-				users = append(users, &user)
-			}
-
-			return users, nil
+			return userConnection(params, stores.Users.List, stores.Users.Count)
 		},
 	}
 }
@@ -171,7 +81,7 @@ func readCreateUserSchema() *graphql.Field {
 			"email":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 			"password":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 			"phone":       &graphql.ArgumentConfig{Type: graphql.String},
-			"dateOfBirth": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			"dateOfBirth": &graphql.ArgumentConfig{Type: graphql.NewNonNull(dateType)},
 			"isActive":    &graphql.ArgumentConfig{Type: graphql.Boolean},
 		},
 		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
@@ -181,79 +91,39 @@ func readCreateUserSchema() *graphql.Field {
 			email, _ := params.Args["email"].(string)
 			password, _ := params.Args["password"].(string)
 			phone, _ := params.Args["phone"].(string)
-			dateOfBirth, _ := params.Args["dateOfBirth"].(string)
+			dateOfBirth, _ := params.Args["dateOfBirth"].(time.Time)
 			isActive, _ := params.Args["isActive"].(bool)
 
-			hashedPassword, _ := utils.EncryptPassword(password)
-
-			query := fmt.Sprintf(`
-					insert into users (first_name, last_name, email, date_of_birth, is_active, phone, "password", user_name)
-					values
-						('%v', '%v', '%v', '%v', %v, '%v', '%v', '%v');
-				`, firstName, lastName, email, dateOfBirth, isActive, phone, string(hashedPassword), userName)
-
-			stmt, err := connection.DB.Prepare(query)
-			if err != nil {
-				return nil, err
+			if dateOfBirth.After(time.Now()) {
+				return nil, apperr.Validation(map[string]string{"dateOfBirth": "can't be in the future"})
 			}
 
-			defer stmt.Close()
-
-			_, err = stmt.Exec()
-
+			hashedPassword, err := utils.EncryptPassword(password)
 			if err != nil {
 				return nil, err
 			}
 
-			query = fmt.Sprintf(`
-				select
-					user_id,
-					user_name,
-					first_name,
-					last_name,
-					email,
-					phone,
-					date_of_birth,
-					is_active
-				from users u where u.user_name = '%v';
-			`, userName)
-
-			rows, err := connection.DB.Query(query)
-			if err != nil {
-				return nil, err
-			}
-
-			var user User
-
-			for rows.Next() {
-				err = rows.Scan(
-					&user.UserId,
-					&user.UserName,
-					&user.FirstName,
-					&user.LastName,
-					&user.Email,
-					&user.Phone,
-					&user.DateOfBirth,
-					&user.IsActive,
-				)
-
-				if err != nil {
-					return nil, err
-				}
-			}
-
-			ts, err := utils.CreateToken(user.UserId)
+			user, err := stores.Users.Create(params.Context, store.NewUser{
+				FirstName:   firstName,
+				LastName:    lastName,
+				UserName:    userName,
+				Email:       email,
+				Password:    hashedPassword,
+				Phone:       phone,
+				DateOfBirth: dateOfBirth,
+				IsActive:    isActive,
+			})
 			if err != nil {
 				return nil, err
 			}
 
-			err = utils.CreateAuth(user.UserId, ts)
+			ts, err := utils.StartSession(user.UserId, sessionMeta(params.Context, ""))
 			if err != nil {
 				return nil, err
 			}
 
 			res := struct {
-				User  User
+				User  *store.User
 				Token Token
 			}{
 				user,
@@ -280,66 +150,40 @@ func readLoginUserSchema() *graphql.Field {
 		Args: graphql.FieldConfigArgument{
 			"userName": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 			"password": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			"device": &graphql.ArgumentConfig{
+				Type:        graphql.String,
+				Description: "A name for the device logging in, shown in the list of sessions",
+			},
 		},
 		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 			userName, _ := params.Args["userName"].(string)
 			password, _ := params.Args["password"].(string)
+			device, _ := params.Args["device"].(string)
 
-			query := fmt.Sprintf(`
-				select
-					user_id,
-					user_name,
-					password,
-					first_name,
-					last_name,
-					email,
-					phone,
-					date_of_birth,
-					is_active
-				from users
-				where user_name = '%v';
-			`, userName)
-			rows, err := connection.DB.Query(query)
-			if err != nil {
-				return nil, err
+			if len([]rune(device)) > maxDeviceLength {
+				return nil, apperr.Validation(map[string]string{"device": "must be at most 100 characters"})
 			}
 
-			var existingPassword []byte
-			var user User
-
-			for rows.Next() {
-				err = rows.Scan(
-					&user.UserId,
-					&user.UserName,
-					&existingPassword,
-					&user.FirstName,
-					&user.LastName,
-					&user.Email,
-					&user.Phone,
-					&user.DateOfBirth,
-					&user.IsActive,
-				)
-				if err != nil {
-					return nil, err
-				}
+			user, existingPassword, err := stores.Users.Credentials(params.Context, userName)
+			if err == store.ErrNotFound {
+				return nil, errWrongCredentials
+			}
+			if err != nil {
+				return nil, err
 			}
 
 			correctPassword := utils.CheckPassword(existingPassword, password)
 			if correctPassword == false {
-				return nil, errors.New("wrong username or password")
-			}
-			ts, err := utils.CreateToken(user.UserId)
-			if err != nil {
-				return nil, err
+				return nil, errWrongCredentials
 			}
 
-			err = utils.CreateAuth(user.UserId, ts)
+			ts, err := utils.StartSession(user.UserId, sessionMeta(params.Context, device))
 			if err != nil {
 				return nil, err
 			}
 
 			res := struct {
-				User  User
+				User  *store.User
 				Token Token
 			}{
 				user,
@@ -366,24 +210,41 @@ func readLogoutSchema() *graphql.Field {
 			"token": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 		},
 		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-			req := params.Context.Value("request").(*http.Request)
-			_, err := utils.TokenValid(req)
+			token, _ := params.Args["token"].(string)
+
+			identity, err := auth.FromContext(params.Context)
 			if err != nil {
 				return nil, err
 			}
 
-			token, _ := params.Args["token"].(string)
-
 			au, err := utils.ExtractTokenMetadataString(token)
 			if err != nil {
-				return nil, err
+				return nil, apperr.Wrap(apperr.Unauthenticated, "the token is invalid or expired", err)
 			}
 
-			deleted, err := utils.DeleteAuth(au.AccessUuid)
-			if err != nil || deleted == 0 {
+			if au.UserId != identity.UserId {
+				return nil, auth.ErrForbidden
+			}
+
+			var deleted int64
+			if au.SessionId != "" {
+				// ending the session drops its refresh token as well
+				var ok bool
+				ok, err = utils.RevokeSession(au.UserId, au.SessionId)
+				if ok {
+					deleted = 1
+				}
+			} else {
+				deleted, err = utils.DeleteAuth(au.AccessUuid)
+			}
+			if err != nil {
 				return nil, err
 			}
 
+			if deleted == 0 {
+				return nil, apperr.New(apperr.Unauthenticated, "the token was already revoked")
+			}
+
 			return struct {
 				Deleted int64
 			}{
@@ -407,44 +268,50 @@ func readRefreshTokenSchema() *graphql.Field {
 		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
 			refreshToken, _ := params.Args["refreshToken"].(string)
 
-			token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return []byte(os.Getenv("REFRESH_SECRET")), nil
-			})
+			token, err := utils.ParseRefreshToken(refreshToken)
 
 			if err != nil {
-				return nil, err
+				return nil, apperr.Wrap(apperr.Unauthenticated, "the refresh token is invalid or expired", err)
 			}
 
 			if _, ok := token.Claims.(jwt.Claims); !ok && !token.Valid {
-				return nil, errors.New("unauthorized")
+				return nil, apperr.New(apperr.Unauthenticated, "unauthorized")
 			}
 
 			claims, ok := token.Claims.(jwt.MapClaims)
 			if ok && token.Valid {
 				refreshUuid, ok := claims["refresh_uuid"].(string)
 				if !ok {
-					return nil, errors.New("failed to get `refresh_uuid`")
+					return nil, apperr.New(apperr.Unauthenticated, "the refresh token has no `refresh_uuid`")
 				}
 
 				userId, ok := claims["user_id"].(string)
 				if !ok {
-					return nil, errors.New("failed to get `user_id`")
+					return nil, apperr.New(apperr.Unauthenticated, "the refresh token has no `user_id`")
 				}
 
-				deleted, err := utils.DeleteAuth(refreshUuid)
-				if err != nil || deleted == 0 {
-					return nil, errors.New("failed to delete old `refresh token`, it probably were deleted already")
+				var ts *utils.TokenDetails
+				if sessionId, _ := claims["session_id"].(string); sessionId != "" {
+					expires, _ := claims["exp"].(float64)
+					ts, err = utils.RotateRefreshToken(userId, sessionId, refreshUuid, time.Unix(int64(expires), 0))
+					if err == utils.ErrRefreshTokenReused {
+						reportRefreshTokenReuse(params.Context, userId, sessionId)
+						return nil, apperr.Wrap(apperr.Unauthenticated, "the refresh token was already used, the session was revoked", err)
+					}
+				} else {
+					// refresh tokens issued before sessions existed open one
+					var deleted int64
+					deleted, err = utils.DeleteAuth(refreshUuid)
+					if err == nil && deleted == 0 {
+						return nil, apperr.New(apperr.Unauthenticated, "the refresh token was already used or revoked")
+					}
+					if err == nil {
+						ts, err = utils.StartSession(userId, sessionMeta(params.Context, ""))
+					}
 				}
-
-				ts, err := utils.CreateToken(userId)
-				if err != nil {
-					return nil, errors.New("failed to create new token")
+				if err == utils.ErrSessionRevoked {
+					return nil, apperr.Wrap(apperr.Unauthenticated, "the refresh token was revoked or expired", err)
 				}
-
-				err = utils.CreateAuth(userId, ts)
 				if err != nil {
 					return nil, err
 				}
@@ -460,7 +327,7 @@ func readRefreshTokenSchema() *graphql.Field {
 
 				return res, nil
 			} else {
-				return nil, errors.New("refresh token expired")
+				return nil, apperr.New(apperr.Unauthenticated, "the refresh token expired")
 			}
 		},
 	}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+)
+
+type apiKeyStore struct {
+	db tracedDB
+}
+
+const apiKeyColumns = `
+	k.key_id,
+	k.user_id,
+	k.name,
+	k.prefix,
+	k.scopes,
+	k.created_at,
+	k.last_used_at
+`
+
+func scanAPIKey(row scanner) (*APIKey, error) {
+	var key APIKey
+
+	err := row.Scan(
+		&key.KeyId,
+		&key.UserId,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Scopes),
+		&key.CreatedAt,
+		&key.LastUsedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (s *apiKeyStore) ByHash(ctx context.Context, hash string) (*APIKey, error) {
+	row := s.db.QueryRowContext(ctx, `
+		select`+apiKeyColumns+`
+		from api_keys as k
+		where k.key_hash = $1 and k.revoked_at is null;
+	`, hash)
+
+	return scanAPIKey(row)
+}
+
+func (s *apiKeyStore) Of(ctx context.Context, userId string) ([]*APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		select`+apiKeyColumns+`
+		from api_keys as k
+		where k.user_id = $1 and k.revoked_at is null
+		order by k.created_at desc, k.key_id desc;
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *apiKeyStore) Create(ctx context.Context, k NewAPIKey) (*APIKey, error) {
+	row := s.db.QueryRowContext(ctx, `
+		insert into api_keys as k (user_id, name, prefix, key_hash, scopes)
+		values ($1, $2, $3, $4, $5)
+		returning`+apiKeyColumns+`;
+	`, k.UserId, k.Name, k.Prefix, k.Hash, pq.Array(k.Scopes))
+
+	return scanAPIKey(row)
+}
+
+func (s *apiKeyStore) Touch(ctx context.Context, keyId string) error {
+	_, err := s.db.ExecContext(ctx, `
+		update api_keys
+		set last_used_at = now()
+		where key_id = $1 and (last_used_at is null or last_used_at < now() - interval '1 minute');
+	`, keyId)
+
+	return err
+}
+
+func (s *apiKeyStore) Revoke(ctx context.Context, userId, keyId string) error {
+	res, err := s.db.ExecContext(ctx, `
+		update api_keys
+		set revoked_at = now()
+		where key_id = $1 and user_id = $2 and revoked_at is null;
+	`, keyId, userId)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type auditStore struct {
+	db tracedDB
+}
+
+func (s *auditStore) Record(ctx context.Context, e AuditEvent) error {
+	details, err := json.Marshal(e.Details)
+	if err != nil {
+		return err
+	}
+
+	if e.Details == nil {
+		details = []byte("{}")
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		insert into audit_events (actor_id, action, target, details)
+		values (nullif($1, '')::int, $2, $3, $4);
+	`, e.ActorId, e.Action, e.Target, string(details))
+
+	return err
+}
@@ -0,0 +1,324 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const exhibitionColumns = `
+	ex.exhibition_id,
+	ex.name,
+	ex.description,
+	ex.start_date,
+	ex.created_date,
+	ex.end_date,
+	ex.owner_id,
+	ex.status
+`
+
+// searchDocument is the text matched by searches, exhibitions_search_idx indexes the same expression
+const searchDocument = `to_tsvector('english', ex.name || ' ' || ex.description)`
+
+var errRelevanceWithoutQuery = apperr.New(apperr.ValidationFailed, "sorting by relevance requires a search query")
+
+// exhibitionSorts maps each order to the expression it sorts on and whether it's descending, ties are
+// broken by id in the same direction
+var exhibitionSorts = map[ExhibitionSort]struct {
+	key  string
+	desc bool
+}{
+	Newest:        {"ex.created_date", true},
+	Oldest:        {"ex.created_date", false},
+	StartsSoonest: {"ex.start_date", false},
+	StartsLatest:  {"ex.start_date", true},
+	Relevance:     {"", true},
+}
+
+func scanExhibition(row scanner, extra ...interface{}) (*Exhibition, error) {
+	var exhibition Exhibition
+
+	dest := []interface{}{
+		&exhibition.ExhibitionId,
+		&exhibition.Name,
+		&exhibition.Description,
+		&exhibition.StartDate,
+		&exhibition.CreatedDate,
+		&exhibition.EndDate,
+		&exhibition.OwnerId,
+		&exhibition.Status,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &exhibition, nil
+}
+
+func queryExhibitions(rows *tracedRows, err error) ([]*Exhibition, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var exhibitions []*Exhibition
+
+	for rows.Next() {
+		exhibition, err := scanExhibition(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		exhibitions = append(exhibitions, exhibition)
+	}
+
+	return exhibitions, rows.Err()
+}
+
+// CursorBy returns the position of the exhibition in a list with the given order
+func (e *Exhibition) CursorBy(sort ExhibitionSort) Cursor {
+	switch sort {
+	case StartsSoonest, StartsLatest:
+		return Cursor{Key: e.StartDate.Format(time.RFC3339Nano), Id: e.ExhibitionId}
+	case Relevance:
+		return Cursor{Key: strconv.FormatFloat(e.Rank, 'g', -1, 64), Id: e.ExhibitionId}
+	default:
+		return Cursor{Key: e.CreatedDate.Format(time.RFC3339Nano), Id: e.ExhibitionId}
+	}
+}
+
+// exhibitionQuery collects the conditions of a filtered query on exhibitions along with their arguments
+type exhibitionQuery struct {
+	where []string
+	args  []interface{}
+	// rank is the relevance of a row to the search, 0 without one
+	rank string
+}
+
+func newExhibitionQuery(filter ExhibitionFilter) *exhibitionQuery {
+	q := &exhibitionQuery{where: []string{"ex.deleted_date is null"}, rank: "0::float8"}
+
+	if filter.OwnerId != "" {
+		q.add("ex.owner_id = " + q.arg(filter.OwnerId) + "::int")
+	}
+
+	if !filter.StartsAfter.IsZero() {
+		q.add("ex.start_date >= " + q.arg(filter.StartsAfter) + "::timestamptz")
+	}
+
+	if !filter.StartsBefore.IsZero() {
+		q.add("ex.start_date <= " + q.arg(filter.StartsBefore) + "::timestamptz")
+	}
+
+	// the status wins over the dates: drafts never start, ended and archived exhibitions are over
+	switch filter.Timing {
+	case Upcoming:
+		q.add("ex.status in ('draft', 'scheduled') and ex.start_date > now()")
+	case Live:
+		q.add("(ex.status = 'live' or (ex.status = 'scheduled' and ex.start_date <= now())) and (ex.end_date is null or ex.end_date > now())")
+	case Past:
+		q.add("ex.status in ('ended', 'archived') or (ex.status in ('scheduled', 'live') and ex.end_date <= now())")
+	}
+
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+
+		q.add("ex.status = any(" + q.arg(pq.Array(statuses)) + "::text[])")
+	}
+
+	if filter.DraftsOf != "" {
+		q.add("ex.status <> 'draft' or ex.owner_id = " + q.arg(filter.DraftsOf) + "::int")
+	}
+
+	if filter.Query != "" {
+		query := "websearch_to_tsquery('english', " + q.arg(filter.Query) + ")"
+		q.add(searchDocument + " @@ " + query)
+		q.rank = "ts_rank(" + searchDocument + ", " + query + ")::float8"
+	}
+
+	return q
+}
+
+// arg adds an argument to the query and returns its placeholder
+func (q *exhibitionQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *exhibitionQuery) add(condition string) {
+	q.where = append(q.where, "("+condition+")")
+}
+
+func (q *exhibitionQuery) conditions() string {
+	return strings.Join(q.where, " and ")
+}
+
+type exhibitionStore struct {
+	db tracedDB
+}
+
+func (s *exhibitionStore) ByID(ctx context.Context, exhibitionId string) (*Exhibition, error) {
+	row := s.db.QueryRowContext(ctx, `
+		select`+exhibitionColumns+`
+		from exhibitions ex
+		where ex.exhibition_id = $1 and ex.deleted_date is null;
+	`, exhibitionId)
+
+	return scanExhibition(row)
+}
+
+func (s *exhibitionStore) List(ctx context.Context, filter ExhibitionFilter, sort ExhibitionSort, page Page) ([]*Exhibition, bool, error) {
+	order, ok := exhibitionSorts[sort]
+	if !ok {
+		order, sort = exhibitionSorts[Newest], Newest
+	}
+
+	q := newExhibitionQuery(filter)
+	key, keyType, check := order.key, "timestamptz", page.checkDate
+
+	if sort == Relevance {
+		if filter.Query == "" {
+			return nil, false, errRelevanceWithoutQuery
+		}
+		key, keyType, check = q.rank, "float8", page.checkNumber
+	}
+
+	if err := check(); err != nil {
+		return nil, false, err
+	}
+
+	direction, comparison := "asc", ">"
+	if order.desc {
+		direction, comparison = "desc", "<"
+	}
+
+	if page.After != nil {
+		q.add("(" + key + ", ex.exhibition_id) " + comparison +
+			" (" + q.arg(page.After.Key) + "::" + keyType + ", " + q.arg(page.After.Id) + "::int)")
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		select`+exhibitionColumns+`, `+q.rank+`
+		from exhibitions ex
+		where `+q.conditions()+`
+		order by `+key+` `+direction+`, ex.exhibition_id `+direction+`
+		limit `+q.arg(page.First+1)+`;
+	`, q.args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer rows.Close()
+
+	var exhibitions []*Exhibition
+
+	for rows.Next() {
+		var rank float64
+
+		exhibition, err := scanExhibition(rows, &rank)
+		if err != nil {
+			return nil, false, err
+		}
+
+		exhibition.Rank = rank
+		exhibitions = append(exhibitions, exhibition)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if page.hasNext(len(exhibitions)) {
+		return exhibitions[:page.First], true, nil
+	}
+
+	return exhibitions, false, nil
+}
+
+func (s *exhibitionStore) Count(ctx context.Context, filter ExhibitionFilter) (int, error) {
+	q := newExhibitionQuery(filter)
+
+	return count(ctx, s.db, `
+		select count(*)
+		from exhibitions ex
+		where `+q.conditions()+`;
+	`, q.args...)
+}
+
+func (s *exhibitionStore) StartedWithin(ctx context.Context, window time.Duration) ([]*Exhibition, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		select`+exhibitionColumns+`
+		from exhibitions ex
+		where
+			ex.start_date <= now() and ex.start_date > now() - $1 * interval '1 second'
+			and ex.status in ('scheduled', 'live')
+			and ex.deleted_date is null;
+	`, window.Seconds())
+
+	return queryExhibitions(rows, err)
+}
+
+func (s *exhibitionStore) Create(ctx context.Context, e NewExhibition) (*Exhibition, error) {
+	row := s.db.QueryRowContext(ctx, `
+		insert into exhibitions as ex (name, description, start_date, end_date, owner_id, status)
+		values ($1, $2, $3, $4, $5, $6)
+		returning`+exhibitionColumns+`;
+	`, e.Name, e.Description, e.StartDate, e.EndDate, e.OwnerId, e.Status)
+
+	return scanExhibition(row)
+}
+
+func (s *exhibitionStore) Update(ctx context.Context, exhibitionId string, changes ExhibitionChanges) (*Exhibition, error) {
+	row := s.db.QueryRowContext(ctx, `
+		update exhibitions as ex
+		set
+			name = coalesce($2, ex.name),
+			description = coalesce($3, ex.description),
+			start_date = coalesce($4::timestamptz, ex.start_date),
+			end_date = case when $6 then null else coalesce($5::timestamptz, ex.end_date) end
+		where ex.exhibition_id = $1 and ex.deleted_date is null
+		returning`+exhibitionColumns+`;
+	`, exhibitionId, changes.Name, changes.Description, changes.StartDate, changes.EndDate, changes.ClearEndDate)
+
+	return scanExhibition(row)
+}
+
+func (s *exhibitionStore) SetStatus(ctx context.Context, exhibitionId string, from, to ExhibitionStatus) (*Exhibition, error) {
+	row := s.db.QueryRowContext(ctx, `
+		update exhibitions as ex
+		set status = $3
+		where ex.exhibition_id = $1 and ex.status = $2 and ex.deleted_date is null
+		returning`+exhibitionColumns+`;
+	`, exhibitionId, from, to)
+
+	exhibition, err := scanExhibition(row)
+	if err == ErrNotFound {
+		return nil, ErrStatusChanged
+	}
+
+	return exhibition, err
+}
+
+func (s *exhibitionStore) Delete(ctx context.Context, exhibitionId string) (*Exhibition, error) {
+	row := s.db.QueryRowContext(ctx, `
+		update exhibitions as ex
+		set deleted_date = now()
+		where ex.exhibition_id = $1 and ex.deleted_date is null
+		returning`+exhibitionColumns+`;
+	`, exhibitionId)
+
+	return scanExhibition(row)
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+)
+
+type friendStore struct {
+	db tracedDB
+}
+
+func (s *friendStore) List(ctx context.Context, userId string) ([]*Friend, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		select
+			f.friend_id,
+			u.user_name,
+			u.first_name,
+			u.last_name
+		from friends f
+			inner join users as u
+			on f.friend_id = u.user_id
+		where f.user_id = $1;
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var friends []*Friend
+
+	for rows.Next() {
+		friend := &Friend{}
+
+		err := rows.Scan(
+			&friend.FriendId,
+			&friend.UserName,
+			&friend.FirstName,
+			&friend.LastName,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		friends = append(friends, friend)
+	}
+
+	return friends, rows.Err()
+}
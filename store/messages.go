@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+)
+
+type messageStore struct {
+	db tracedDB
+}
+
+func (s *messageStore) Conversation(ctx context.Context, userId, otherId string, page Page) ([]*Message, bool, error) {
+	if err := page.checkDate(); err != nil {
+		return nil, false, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		select
+			m.message_id,
+			m.sender_id,
+			m.receiver_id,
+			m."content",
+			m.created_date
+		from message m
+		where
+			(m.sender_id = $4 and m.receiver_id = $5 or m.sender_id = $5 and m.receiver_id = $4)
+			and ($1::timestamptz is null or (m.created_date, m.message_id) < ($1::timestamptz, $2::int))
+		order by m.created_date desc, m.message_id desc
+		limit $3;
+	`, append(page.args(), userId, otherId)...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer rows.Close()
+
+	var messages []*Message
+
+	for rows.Next() {
+		message := &Message{}
+
+		err := rows.Scan(
+			&message.MessageId,
+			&message.SenderId,
+			&message.ReceiverId,
+			&message.Content,
+			&message.CreatedDate,
+		)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		decodedStr, _ := hex.DecodeString(message.Content)
+		message.Content = string(decodedStr)
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if page.hasNext(len(messages)) {
+		return messages[:page.First], true, nil
+	}
+
+	return messages, false, nil
+}
+
+func (s *messageStore) Recent(ctx context.Context, userId string) ([]*RecentMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		select
+			case
+				when u2.receiver_id = $1 then u2.sender_id
+				else u2.receiver_id
+			end as receiver_id,
+			u2.user_name,
+			u2.first_name,
+			u2.last_name,
+			u2.created_date
+		from
+			(select
+				distinct on(u.user_name) user_name,
+				receiver_id,
+				sender_id,
+				u.first_name,
+				u.last_name,
+				created_date
+			from (select distinct on(receiver_id) receiver_id, sender_id, created_date
+				from message
+				where sender_id = $1 or receiver_id = $1
+				order by receiver_id, created_date desc) message
+				inner join users as u on
+				(case
+					when receiver_id = $1 then sender_id = u.user_id
+					when sender_id = $1 then receiver_id = user_id
+				end)
+			) as u2
+		order by created_date desc;
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var messages []*RecentMessage
+
+	for rows.Next() {
+		recentMes := &RecentMessage{}
+
+		err := rows.Scan(
+			&recentMes.UserId,
+			&recentMes.UserName,
+			&recentMes.FirstName,
+			&recentMes.LastName,
+			&recentMes.CreatedDate,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, recentMes)
+	}
+
+	return messages, rows.Err()
+}
+
+func (s *messageStore) Save(ctx context.Context, m *Message) error {
+	return s.db.QueryRowContext(ctx, `
+		insert into message (
+			sender_id,
+			receiver_id,
+			"content"
+		) values ($1, $2, $3)
+		returning message_id, created_date;
+	`, m.SenderId, m.ReceiverId, hex.EncodeToString([]byte(m.Content))).Scan(&m.MessageId, &m.CreatedDate)
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = apperr.New(apperr.ValidationFailed, "invalid cursor")
+
+// Cursor is a position in a sorted list, Key is the value of the sort column and Id breaks ties
+type Cursor struct {
+	Key string
+	Id  string
+}
+
+// Page selects up to First records following the After cursor, the list starts from the top when After is nil
+type Page struct {
+	First int
+	After *Cursor
+}
+
+// EncodeCursor returns the opaque form of the cursor handed to clients
+func EncodeCursor(c Cursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Key + "|" + c.Id))
+}
+
+// DecodeCursor parses a cursor made by EncodeCursor, ErrInvalidCursor when it isn't one
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// ids never hold the separator, keys might
+	sep := strings.LastIndex(string(raw), "|")
+	if sep <= 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	key, id := string(raw[:sep]), string(raw[sep+1:])
+
+	// ids are serial
+	if _, err := strconv.Atoi(id); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{Key: key, Id: id}, nil
+}
+
+// checkDate makes sure the cursor of a list sorted by a date holds one
+func (p Page) checkDate() error {
+	if p.After == nil {
+		return nil
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, p.After.Key); err != nil {
+		return ErrInvalidCursor
+	}
+
+	return nil
+}
+
+// checkNumber makes sure the cursor of a list sorted by a number holds one
+func (p Page) checkNumber() error {
+	if p.After == nil {
+		return nil
+	}
+
+	if _, err := strconv.ParseFloat(p.After.Key, 64); err != nil {
+		return ErrInvalidCursor
+	}
+
+	return nil
+}
+
+// args returns the cursor bounds and the limit of a page query, the extra row tells if there is a next page
+func (p Page) args() []interface{} {
+	if p.After == nil {
+		return []interface{}{nil, nil, p.First + 1}
+	}
+
+	return []interface{}{p.After.Key, p.After.Id, p.First + 1}
+}
+
+// hasNext reports whether a query returning n rows for the page found more than fit in it
+func (p Page) hasNext(n int) bool {
+	return n > p.First
+}
+
+// count runs a query returning the total number of records a list can page through
+func count(ctx context.Context, db tracedDB, query string, args ...interface{}) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (u *User) Cursor() Cursor {
+	return Cursor{Key: u.CreatedDate.Format(time.RFC3339Nano), Id: u.UserId}
+}
+
+func (m *Message) Cursor() Cursor {
+	return Cursor{Key: m.CreatedDate.Format(time.RFC3339Nano), Id: m.MessageId}
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, c := range []Cursor{
+		{Key: time.Date(2024, 5, 1, 10, 0, 0, 123, time.UTC).Format(time.RFC3339Nano), Id: "42"},
+		{Key: "0.0607927", Id: "7"},
+		{Key: "a|b", Id: "1"},
+	} {
+		decoded, err := DecodeCursor(EncodeCursor(c))
+		if err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+
+		if *decoded != c {
+			t.Fatalf("expected %+v, got %+v", c, *decoded)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsForgedValues(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	for name, value := range map[string]string{
+		"empty":          "",
+		"not base64":     "%%%",
+		"padded base64":  base64.URLEncoding.EncodeToString([]byte("2024-05-01T10:00:00Z|4")),
+		"no separator":   encode("2024-05-01T10:00:00Z"),
+		"no key":         encode("|4"),
+		"no id":          encode("2024-05-01T10:00:00Z|"),
+		"non numeric id": encode("2024-05-01T10:00:00Z|4 or 1=1"),
+	} {
+		if _, err := DecodeCursor(value); err != ErrInvalidCursor {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+}
+
+func TestPageChecksCursorKeys(t *testing.T) {
+	date := Page{First: 10, After: &Cursor{Key: "2024-05-01T10:00:00Z", Id: "1"}}
+	if err := date.checkDate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := date.checkNumber(); err != ErrInvalidCursor {
+		t.Fatalf("a date was accepted as a number: %v", err)
+	}
+
+	number := Page{First: 10, After: &Cursor{Key: "0.5", Id: "1"}}
+	if err := number.checkDate(); err != ErrInvalidCursor {
+		t.Fatalf("a number was accepted as a date: %v", err)
+	}
+
+	if !number.hasNext(11) || number.hasNext(10) {
+		t.Fatal("hasNext should only report the extra row")
+	}
+}
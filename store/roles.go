@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+)
+
+type roleStore struct {
+	db tracedDB
+}
+
+func (s *roleStore) Of(ctx context.Context, userId string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		select 'admin' from admins where user_id = $1
+		union all
+		select 'producer' from producers where user_id = $1;
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var roles []string
+
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (s *roleStore) Admins(ctx context.Context, page Page) ([]*User, bool, error) {
+	return pageUsers(ctx, s.db, page, `
+		select`+userColumns+`
+		from admins a
+			inner join users u on u.user_id = a.user_id
+		where `+usersAfter+usersNewestFirst+`;
+	`)
+}
+
+func (s *roleStore) Producers(ctx context.Context, page Page) ([]*User, bool, error) {
+	return pageUsers(ctx, s.db, page, `
+		select`+userColumns+`
+		from producers p
+			inner join users u on u.user_id = p.user_id
+		where `+usersAfter+usersNewestFirst+`;
+	`)
+}
+
+const audienceFilter = `
+	u.user_id not in
+		(select user_id from admins)
+	and u.user_id not in
+		(select user_id from producers)
+`
+
+func (s *roleStore) Audience(ctx context.Context, page Page) ([]*User, bool, error) {
+	return pageUsers(ctx, s.db, page, `
+		select`+userColumns+`
+		from users u
+		where`+audienceFilter+`and `+usersAfter+usersNewestFirst+`;
+	`)
+}
+
+func (s *roleStore) CountAdmins(ctx context.Context) (int, error) {
+	return count(ctx, s.db, `select count(*) from admins;`)
+}
+
+func (s *roleStore) CountProducers(ctx context.Context) (int, error) {
+	return count(ctx, s.db, `select count(*) from producers;`)
+}
+
+func (s *roleStore) CountAudience(ctx context.Context) (int, error) {
+	return count(ctx, s.db, `
+		select count(*)
+		from users u
+		where`+audienceFilter+`;
+	`)
+}
+
+func (s *roleStore) AddAdmin(ctx context.Context, userId string) error {
+	_, err := s.db.ExecContext(ctx, `insert into admins (user_id) values ($1);`, userId)
+	return err
+}
+
+func (s *roleStore) AddProducer(ctx context.Context, userId string) error {
+	_, err := s.db.ExecContext(ctx, `insert into producers (user_id) values ($1);`, userId)
+	return err
+}
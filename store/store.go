@@ -0,0 +1,317 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"time"
+)
+
+var ErrNotFound = apperr.New(apperr.NotFound, "record not found")
+
+var ErrStatusChanged = apperr.New(apperr.FailedPrecondition, "the status was changed by another request")
+
+type User struct {
+	UserId    string `json:"user_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	UserName  string `json:"user_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	// DateOfBirth is a date, its time of day is midnight UTC
+	DateOfBirth time.Time `json:"date_of_birth"`
+	IsActive    bool      `json:"is_active"`
+	CreatedDate time.Time `json:"created_date"`
+}
+
+type NewUser struct {
+	FirstName   string
+	LastName    string
+	UserName    string
+	Email       string
+	Password    []byte
+	Phone       string
+	DateOfBirth time.Time
+	IsActive    bool
+}
+
+type Exhibition struct {
+	ExhibitionId string    `json:"exhibition_id,omitempty"`
+	Name         string    `json:"name,omitempty"`
+	Description  string    `json:"description,omitempty"`
+	StartDate    time.Time `json:"start_date"`
+	CreatedDate  time.Time `json:"created_date"`
+	// EndDate is nil while the exhibition has no planned end
+	EndDate *time.Time       `json:"end_date,omitempty"`
+	OwnerId string           `json:"owner_id,omitempty"`
+	Status  ExhibitionStatus `json:"status,omitempty"`
+	// Rank is the relevance of the exhibition to the search that found it
+	Rank float64 `json:"-"`
+}
+
+type ExhibitionStatus string
+
+const (
+	StatusDraft     ExhibitionStatus = "draft"
+	StatusScheduled ExhibitionStatus = "scheduled"
+	StatusLive      ExhibitionStatus = "live"
+	StatusEnded     ExhibitionStatus = "ended"
+	StatusArchived  ExhibitionStatus = "archived"
+)
+
+// exhibitionTransitions lists the statuses each status may change to
+var exhibitionTransitions = map[ExhibitionStatus][]ExhibitionStatus{
+	StatusDraft:     {StatusScheduled, StatusArchived},
+	StatusScheduled: {StatusDraft, StatusLive, StatusArchived},
+	StatusLive:      {StatusEnded},
+	StatusEnded:     {StatusArchived},
+}
+
+// CanBecome reports whether an exhibition may change from the status to the given one
+func (s ExhibitionStatus) CanBecome(to ExhibitionStatus) bool {
+	for _, allowed := range exhibitionTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Timing of an exhibition relative to now
+type Timing string
+
+const (
+	// Upcoming drafts and scheduled exhibitions start in the future
+	Upcoming Timing = "upcoming"
+	// Live exhibitions were started, or are scheduled and past their start date, and haven't ended yet.
+	// Those without an end date stay live until they are ended
+	Live Timing = "live"
+	// Past exhibitions were ended or archived, or are scheduled or live and past their end date
+	Past Timing = "past"
+)
+
+// ExhibitionFilter narrows a list of exhibitions, zero values don't filter
+type ExhibitionFilter struct {
+	OwnerId string
+	// StartsAfter and StartsBefore bound the start date, both inclusive
+	StartsAfter  time.Time
+	StartsBefore time.Time
+	Timing       Timing
+	// Query is matched against the name and description with full-text search
+	Query string
+	// Statuses lists the statuses to include, every one when empty
+	Statuses []ExhibitionStatus
+	// DraftsOf restricts the drafts listed to those of the user, every draft is listed when empty
+	DraftsOf string
+}
+
+type ExhibitionSort string
+
+const (
+	Newest        ExhibitionSort = "newest"
+	Oldest        ExhibitionSort = "oldest"
+	StartsSoonest ExhibitionSort = "startsSoonest"
+	StartsLatest  ExhibitionSort = "startsLatest"
+	// Relevance orders search results by rank, it requires a Query
+	Relevance ExhibitionSort = "relevance"
+)
+
+type NewExhibition struct {
+	Name        string
+	Description string
+	StartDate   time.Time
+	EndDate     *time.Time
+	OwnerId     string
+	Status      ExhibitionStatus
+}
+
+// ExhibitionChanges lists the fields to update, nil ones are left as they are
+type ExhibitionChanges struct {
+	Name        *string
+	Description *string
+	StartDate   *time.Time
+	EndDate     *time.Time
+	// ClearEndDate removes the end date, leaving the exhibition open ended
+	ClearEndDate bool
+}
+
+type Message struct {
+	MessageId   string    `json:"message_id"`
+	SenderId    string    `json:"sender_id"`
+	ReceiverId  string    `json:"receiver_id"`
+	Content     string    `json:"content"`
+	CreatedDate time.Time `json:"created_date"`
+}
+
+type RecentMessage struct {
+	UserId      string
+	UserName    string
+	FirstName   string
+	LastName    string
+	CreatedDate time.Time
+}
+
+type Friend struct {
+	FriendId  string
+	UserName  string
+	FirstName string
+	LastName  string
+}
+
+// ServiceToken is a long lived access token issued to an encoder, bot or other service
+type ServiceToken struct {
+	TokenId   string
+	UserId    string
+	Label     string
+	Scopes    []string
+	ExpiresAt time.Time
+	// CreatedBy is the admin who issued the token, empty once that user is deleted
+	CreatedBy string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+type NewServiceToken struct {
+	TokenId   string
+	UserId    string
+	Label     string
+	Scopes    []string
+	ExpiresAt time.Time
+	CreatedBy string
+}
+
+// APIKey is a personal access token created by a user for an integration, only its hash is stored
+type APIKey struct {
+	KeyId  string
+	UserId string
+	Name   string
+	// Prefix is the start of the key, enough for its owner to recognise it
+	Prefix     string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+type NewAPIKey struct {
+	UserId string
+	Name   string
+	Prefix string
+	Hash   string
+	Scopes []string
+}
+
+// AuditEvent records a sensitive action, Target identifies what it was done to
+type AuditEvent struct {
+	ActorId string
+	Action  string
+	Target  string
+	Details map[string]interface{}
+}
+
+type UserStore interface {
+	ByID(ctx context.Context, userId string) (*User, error)
+	// ByIDs looks up several users at once, ids without a user are missing from the result
+	ByIDs(ctx context.Context, userIds []string) (map[string]*User, error)
+	// Credentials returns the user together with the stored password hash
+	Credentials(ctx context.Context, userName string) (*User, []byte, error)
+	// List returns a page of users newest first and whether more follow it
+	List(ctx context.Context, page Page) ([]*User, bool, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, u NewUser) (*User, error)
+}
+
+type ExhibitionStore interface {
+	ByID(ctx context.Context, exhibitionId string) (*Exhibition, error)
+	// List returns a page of the exhibitions matching the filter in the given order and whether more follow it
+	List(ctx context.Context, filter ExhibitionFilter, sort ExhibitionSort, page Page) ([]*Exhibition, bool, error)
+	Count(ctx context.Context, filter ExhibitionFilter) (int, error)
+	// StartedWithin returns exhibitions whose start date is inside the last window
+	StartedWithin(ctx context.Context, window time.Duration) ([]*Exhibition, error)
+	Create(ctx context.Context, e NewExhibition) (*Exhibition, error)
+	Update(ctx context.Context, exhibitionId string, changes ExhibitionChanges) (*Exhibition, error)
+	// SetStatus moves the exhibition from one status to another, ErrStatusChanged when it's no longer in from
+	SetStatus(ctx context.Context, exhibitionId string, from, to ExhibitionStatus) (*Exhibition, error)
+	// Delete hides the exhibition and returns it, it's kept in the database
+	Delete(ctx context.Context, exhibitionId string) (*Exhibition, error)
+}
+
+type RoleStore interface {
+	// Of returns the names of the roles granted to the user
+	Of(ctx context.Context, userId string) ([]string, error)
+	// Admins, Producers and Audience return a page of users newest first and whether more follow it
+	Admins(ctx context.Context, page Page) ([]*User, bool, error)
+	Producers(ctx context.Context, page Page) ([]*User, bool, error)
+	Audience(ctx context.Context, page Page) ([]*User, bool, error)
+	CountAdmins(ctx context.Context) (int, error)
+	CountProducers(ctx context.Context) (int, error)
+	CountAudience(ctx context.Context) (int, error)
+	AddAdmin(ctx context.Context, userId string) error
+	AddProducer(ctx context.Context, userId string) error
+}
+
+type MessageStore interface {
+	// Conversation returns a page of the messages exchanged between two users newest first and whether
+	// more follow it
+	Conversation(ctx context.Context, userId, otherId string, page Page) ([]*Message, bool, error)
+	Recent(ctx context.Context, userId string) ([]*RecentMessage, error)
+	// Save stores the message and fills in its id and creation date
+	Save(ctx context.Context, m *Message) error
+}
+
+type FriendStore interface {
+	List(ctx context.Context, userId string) ([]*Friend, error)
+}
+
+type ServiceTokenStore interface {
+	ByID(ctx context.Context, tokenId string) (*ServiceToken, error)
+	// List returns every token newest first, revoked and expired ones included
+	List(ctx context.Context) ([]*ServiceToken, error)
+	Create(ctx context.Context, t NewServiceToken) (*ServiceToken, error)
+	// Revoke marks the token as revoked, a token revoked earlier keeps its revocation date
+	Revoke(ctx context.Context, tokenId string) (*ServiceToken, error)
+}
+
+type APIKeyStore interface {
+	// ByHash returns the key with the given hash, ErrNotFound once it's revoked
+	ByHash(ctx context.Context, hash string) (*APIKey, error)
+	// Of returns the keys of the user newest first, revoked ones excluded
+	Of(ctx context.Context, userId string) ([]*APIKey, error)
+	Create(ctx context.Context, k NewAPIKey) (*APIKey, error)
+	// Touch records that the key was just used, the timestamp is only refreshed once per minute
+	Touch(ctx context.Context, keyId string) error
+	// Revoke disables a key of the user, ErrNotFound when the user has no such key
+	Revoke(ctx context.Context, userId, keyId string) error
+}
+
+type AuditStore interface {
+	Record(ctx context.Context, e AuditEvent) error
+}
+
+// Store groups every repository used by the GraphQL schema and the gRPC server
+type Store struct {
+	Users       UserStore
+	Exhibitions ExhibitionStore
+	Roles       RoleStore
+	Messages    MessageStore
+	Friends     FriendStore
+	Tokens      ServiceTokenStore
+	APIKeys     APIKeyStore
+	Audit       AuditStore
+}
+
+// New returns a Store backed by Postgres
+func New(sqlDB *sql.DB) *Store {
+	db := tracedDB{sqlDB}
+
+	return &Store{
+		Users:       &userStore{db},
+		Exhibitions: &exhibitionStore{db},
+		Roles:       &roleStore{db},
+		Messages:    &messageStore{db},
+		Friends:     &friendStore{db},
+		Tokens:      &serviceTokenStore{db},
+		APIKeys:     &apiKeyStore{db},
+		Audit:       &auditStore{db},
+	}
+}
@@ -0,0 +1,370 @@
+// Package storetest keeps records in memory behind the store interfaces, for the tests of the packages
+// using them. Only the methods those tests reach are implemented, the others panic.
+package storetest
+
+import (
+	"context"
+	"github.com/gloompi/tantora-back/app/store"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Fakes holds the in-memory stores, tests seed and inspect them directly
+type Fakes struct {
+	Users       *Users
+	Roles       *Roles
+	Exhibitions *Exhibitions
+	Tokens      *Tokens
+	APIKeys     *APIKeys
+	Audit       *Audit
+}
+
+func New() *Fakes {
+	return &Fakes{
+		Users:       &Users{users: map[string]*store.User{}},
+		Roles:       &Roles{roles: map[string][]string{}},
+		Exhibitions: &Exhibitions{exhibitions: map[string]*store.Exhibition{}, deleted: map[string]bool{}},
+		Tokens:      &Tokens{tokens: map[string]*store.ServiceToken{}},
+		APIKeys:     &APIKeys{keys: map[string]*apiKey{}},
+		Audit:       &Audit{},
+	}
+}
+
+// Store groups the fakes the way store.New groups the Postgres stores
+func (f *Fakes) Store() *store.Store {
+	return &store.Store{
+		Users:       f.Users,
+		Roles:       f.Roles,
+		Exhibitions: f.Exhibitions,
+		Tokens:      f.Tokens,
+		APIKeys:     f.APIKeys,
+		Audit:       f.Audit,
+	}
+}
+
+// AddUser stores a user with the given roles, none makes it a member of the audience
+func (f *Fakes) AddUser(userId string, roles ...string) *store.User {
+	user := &store.User{UserId: userId, UserName: "user" + userId, IsActive: true, CreatedDate: time.Now()}
+
+	f.Users.mu.Lock()
+	f.Users.users[userId] = user
+	f.Users.mu.Unlock()
+
+	f.Roles.mu.Lock()
+	f.Roles.roles[userId] = roles
+	f.Roles.mu.Unlock()
+
+	return user
+}
+
+type Users struct {
+	store.UserStore
+
+	mu    sync.Mutex
+	users map[string]*store.User
+}
+
+func (s *Users) ByID(ctx context.Context, userId string) (*store.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (s *Users) ByIDs(ctx context.Context, userIds []string) (map[string]*store.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := map[string]*store.User{}
+	for _, id := range userIds {
+		if user, ok := s.users[id]; ok {
+			found[id] = user
+		}
+	}
+
+	return found, nil
+}
+
+func (s *Users) List(ctx context.Context, page store.Page) ([]*store.User, bool, error) {
+	return []*store.User{}, false, nil
+}
+
+func (s *Users) Count(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.users), nil
+}
+
+type Roles struct {
+	store.RoleStore
+
+	mu    sync.Mutex
+	roles map[string][]string
+}
+
+func (s *Roles) Of(ctx context.Context, userId string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.roles[userId], nil
+}
+
+func (s *Roles) Admins(ctx context.Context, page store.Page) ([]*store.User, bool, error) {
+	return []*store.User{}, false, nil
+}
+
+func (s *Roles) CountAdmins(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (s *Roles) AddAdmin(ctx context.Context, userId string) error {
+	return s.add(userId, "admin")
+}
+
+func (s *Roles) AddProducer(ctx context.Context, userId string) error {
+	return s.add(userId, "producer")
+}
+
+func (s *Roles) add(userId, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roles[userId] = append(s.roles[userId], role)
+	return nil
+}
+
+type Exhibitions struct {
+	store.ExhibitionStore
+
+	mu          sync.Mutex
+	exhibitions map[string]*store.Exhibition
+	// deleted exhibitions stay in exhibitions like the rows kept in the database
+	deleted map[string]bool
+}
+
+func (s *Exhibitions) ByID(ctx context.Context, exhibitionId string) (*store.Exhibition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exhibition, ok := s.exhibitions[exhibitionId]
+	if !ok || s.deleted[exhibitionId] {
+		return nil, store.ErrNotFound
+	}
+
+	return exhibition, nil
+}
+
+func (s *Exhibitions) Create(ctx context.Context, e store.NewExhibition) (*store.Exhibition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exhibition := &store.Exhibition{
+		ExhibitionId: strconv.Itoa(len(s.exhibitions) + 1),
+		Name:         e.Name,
+		Description:  e.Description,
+		StartDate:    e.StartDate,
+		EndDate:      e.EndDate,
+		OwnerId:      e.OwnerId,
+		Status:       e.Status,
+		CreatedDate:  time.Now(),
+	}
+	s.exhibitions[exhibition.ExhibitionId] = exhibition
+
+	return exhibition, nil
+}
+
+func (s *Exhibitions) Delete(ctx context.Context, exhibitionId string) (*store.Exhibition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exhibition, ok := s.exhibitions[exhibitionId]
+	if !ok || s.deleted[exhibitionId] {
+		return nil, store.ErrNotFound
+	}
+	s.deleted[exhibitionId] = true
+
+	return exhibition, nil
+}
+
+type Tokens struct {
+	store.ServiceTokenStore
+
+	mu     sync.Mutex
+	tokens map[string]*store.ServiceToken
+}
+
+func (s *Tokens) ByID(ctx context.Context, tokenId string) (*store.ServiceToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenId]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return token, nil
+}
+
+func (s *Tokens) List(ctx context.Context) ([]*store.ServiceToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := []*store.ServiceToken{}
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+func (s *Tokens) Create(ctx context.Context, t store.NewServiceToken) (*store.ServiceToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := &store.ServiceToken{
+		TokenId:   t.TokenId,
+		UserId:    t.UserId,
+		Label:     t.Label,
+		Scopes:    t.Scopes,
+		ExpiresAt: t.ExpiresAt,
+		CreatedBy: t.CreatedBy,
+		CreatedAt: time.Now(),
+	}
+	s.tokens[token.TokenId] = token
+
+	return token, nil
+}
+
+func (s *Tokens) Revoke(ctx context.Context, tokenId string) (*store.ServiceToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenId]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	if token.RevokedAt == nil {
+		now := time.Now()
+		token.RevokedAt = &now
+	}
+
+	return token, nil
+}
+
+type apiKey struct {
+	store.APIKey
+	hash    string
+	revoked bool
+}
+
+type APIKeys struct {
+	store.APIKeyStore
+
+	mu   sync.Mutex
+	keys map[string]*apiKey
+}
+
+func (s *APIKeys) ByHash(ctx context.Context, hash string) (*store.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.keys {
+		if key.hash == hash && !key.revoked {
+			found := key.APIKey
+			return &found, nil
+		}
+	}
+
+	return nil, store.ErrNotFound
+}
+
+func (s *APIKeys) Of(ctx context.Context, userId string) ([]*store.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []*store.APIKey{}
+	for _, key := range s.keys {
+		if key.UserId == userId && !key.revoked {
+			found := key.APIKey
+			keys = append(keys, &found)
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *APIKeys) Create(ctx context.Context, k store.NewAPIKey) (*store.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := &apiKey{
+		APIKey: store.APIKey{
+			KeyId:     strconv.Itoa(len(s.keys) + 1),
+			UserId:    k.UserId,
+			Name:      k.Name,
+			Prefix:    k.Prefix,
+			Scopes:    k.Scopes,
+			CreatedAt: time.Now(),
+		},
+		hash: k.Hash,
+	}
+	s.keys[key.KeyId] = key
+
+	created := key.APIKey
+	return &created, nil
+}
+
+func (s *APIKeys) Touch(ctx context.Context, keyId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[keyId]; ok {
+		now := time.Now()
+		key.LastUsedAt = &now
+	}
+
+	return nil
+}
+
+func (s *APIKeys) Revoke(ctx context.Context, userId, keyId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[keyId]
+	if !ok || key.UserId != userId || key.revoked {
+		return store.ErrNotFound
+	}
+
+	key.revoked = true
+	return nil
+}
+
+// Audit remembers the recorded events in order
+type Audit struct {
+	mu     sync.Mutex
+	events []store.AuditEvent
+}
+
+func (s *Audit) Record(ctx context.Context, e store.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, e)
+	return nil
+}
+
+// Events returns the events recorded so far
+func (s *Audit) Events() []store.AuditEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]store.AuditEvent{}, s.events...)
+}
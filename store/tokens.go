@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+)
+
+type serviceTokenStore struct {
+	db tracedDB
+}
+
+const serviceTokenColumns = `
+	t.token_id,
+	t.user_id,
+	t.label,
+	t.scopes,
+	t.expires_at,
+	coalesce(t.created_by::text, ''),
+	t.created_at,
+	t.revoked_at
+`
+
+func scanServiceToken(row scanner) (*ServiceToken, error) {
+	var token ServiceToken
+
+	err := row.Scan(
+		&token.TokenId,
+		&token.UserId,
+		&token.Label,
+		pq.Array(&token.Scopes),
+		&token.ExpiresAt,
+		&token.CreatedBy,
+		&token.CreatedAt,
+		&token.RevokedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (s *serviceTokenStore) ByID(ctx context.Context, tokenId string) (*ServiceToken, error) {
+	row := s.db.QueryRowContext(ctx, `
+		select`+serviceTokenColumns+`
+		from service_tokens as t
+		where t.token_id = $1;
+	`, tokenId)
+
+	return scanServiceToken(row)
+}
+
+func (s *serviceTokenStore) List(ctx context.Context) ([]*ServiceToken, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		select`+serviceTokenColumns+`
+		from service_tokens as t
+		order by t.created_at desc, t.token_id;
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tokens := []*ServiceToken{}
+	for rows.Next() {
+		token, err := scanServiceToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (s *serviceTokenStore) Create(ctx context.Context, t NewServiceToken) (*ServiceToken, error) {
+	row := s.db.QueryRowContext(ctx, `
+		insert into service_tokens as t (token_id, user_id, label, scopes, expires_at, created_by)
+		values ($1, $2, $3, $4, $5, nullif($6, '')::int)
+		returning`+serviceTokenColumns+`;
+	`, t.TokenId, t.UserId, t.Label, pq.Array(t.Scopes), t.ExpiresAt, t.CreatedBy)
+
+	return scanServiceToken(row)
+}
+
+func (s *serviceTokenStore) Revoke(ctx context.Context, tokenId string) (*ServiceToken, error) {
+	row := s.db.QueryRowContext(ctx, `
+		update service_tokens as t
+		set revoked_at = coalesce(t.revoked_at, now())
+		where t.token_id = $1
+		returning`+serviceTokenColumns+`;
+	`, tokenId)
+
+	return scanServiceToken(row)
+}
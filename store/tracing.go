@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/gloompi/tantora-back/app/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"sync"
+)
+
+// tracedDB records a span for every statement the stores run
+type tracedDB struct {
+	*sql.DB
+}
+
+func startStatement(ctx context.Context, query string) (context.Context, trace.Span) {
+	query = strings.Join(strings.Fields(query), " ")
+
+	name := "sql"
+	if i := strings.IndexByte(query, ' '); i > 0 {
+		name = "sql " + strings.ToLower(query[:i])
+	}
+
+	return tracing.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBStatement(query)),
+	)
+}
+
+// tracedRows ends the span of its query once the rows are read or closed, fetching them is part of the query
+type tracedRows struct {
+	*sql.Rows
+	span trace.Span
+	once sync.Once
+}
+
+func (r *tracedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+
+	r.end()
+	return false
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	r.end()
+	return err
+}
+
+func (r *tracedRows) end() {
+	r.once.Do(func() {
+		tracing.End(r.span, r.Rows.Err())
+	})
+}
+
+func (db tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*tracedRows, error) {
+	ctx, span := startStatement(ctx, query)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (db tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startStatement(ctx, query)
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	tracing.End(span, row.Err())
+	return row
+}
+
+func (db tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startStatement(ctx, query)
+	res, err := db.DB.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return res, err
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"testing"
+)
+
+// rowsDriver answers every query with the ids 1 and 2
+type rowsDriver struct{}
+
+type rowsConn struct{}
+
+type rowsStmt struct{}
+
+type idRows struct {
+	next int
+}
+
+func (rowsDriver) Open(name string) (driver.Conn, error) { return rowsConn{}, nil }
+
+func (rowsConn) Prepare(query string) (driver.Stmt, error) { return rowsStmt{}, nil }
+func (rowsConn) Close() error                              { return nil }
+func (rowsConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func (rowsStmt) Close() error  { return nil }
+func (rowsStmt) NumInput() int { return -1 }
+func (rowsStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (rowsStmt) Query(args []driver.Value) (driver.Rows, error) { return &idRows{}, nil }
+
+func (r *idRows) Columns() []string { return []string{"id"} }
+func (r *idRows) Close() error      { return nil }
+func (r *idRows) Next(dest []driver.Value) error {
+	if r.next == 2 {
+		return io.EOF
+	}
+	r.next++
+	dest[0] = int64(r.next)
+	return nil
+}
+
+func init() {
+	sql.Register("store-test-rows", rowsDriver{})
+}
+
+func TestQuerySpanEndsWithTheRows(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	sqlDB, err := sql.Open("store-test-rows", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	db := tracedDB{sqlDB}
+
+	for _, readAll := range []bool{true, false} {
+		before := len(recorder.Ended())
+
+		rows, err := db.QueryContext(context.Background(), "select id from things")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(recorder.Ended()) != before {
+			t.Fatal("the span ended before the rows were read")
+		}
+
+		if readAll {
+			for rows.Next() {
+			}
+		} else {
+			rows.Next()
+		}
+
+		rows.Close()
+
+		if len(recorder.Ended()) != before+1 {
+			t.Fatalf("%d spans ended, want 1", len(recorder.Ended())-before)
+		}
+	}
+}
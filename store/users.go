@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"strconv"
+)
+
+const userColumns = `
+	u.user_id,
+	u.user_name,
+	u.first_name,
+	u.last_name,
+	u.email,
+	u.phone,
+	u.date_of_birth,
+	u.is_active,
+	u.created_date
+`
+
+// usersAfter and usersNewestFirst frame the queries of a page of users, they take the page arguments
+// as $1, $2 and $3
+const usersAfter = `($1::timestamptz is null or (u.created_date, u.user_id) < ($1::timestamptz, $2::int))`
+
+const usersNewestFirst = `
+	order by u.created_date desc, u.user_id desc
+	limit $3
+`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner, extra ...interface{}) (*User, error) {
+	var user User
+
+	dest := []interface{}{
+		&user.UserId,
+		&user.UserName,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Phone,
+		&user.DateOfBirth,
+		&user.IsActive,
+		&user.CreatedDate,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func queryUsers(ctx context.Context, db tracedDB, query string, args ...interface{}) ([]*User, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var users []*User
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func pageUsers(ctx context.Context, db tracedDB, page Page, query string) ([]*User, bool, error) {
+	if err := page.checkDate(); err != nil {
+		return nil, false, err
+	}
+
+	users, err := queryUsers(ctx, db, query, page.args()...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if page.hasNext(len(users)) {
+		return users[:page.First], true, nil
+	}
+
+	return users, false, nil
+}
+
+type userStore struct {
+	db tracedDB
+}
+
+func (s *userStore) ByID(ctx context.Context, userId string) (*User, error) {
+	row := s.db.QueryRowContext(ctx, `
+		select`+userColumns+`
+		from users u
+		where u.user_id = $1;
+	`, userId)
+
+	return scanUser(row)
+}
+
+func (s *userStore) ByIDs(ctx context.Context, userIds []string) (map[string]*User, error) {
+	found := map[string]*User{}
+
+	// ids are serial, anything else can't match and would fail the cast
+	var ids []string
+	for _, id := range userIds {
+		if _, err := strconv.Atoi(id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	users, err := queryUsers(ctx, s.db, `
+		select`+userColumns+`
+		from users u
+		where u.user_id = any($1::int[]);
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		found[user.UserId] = user
+	}
+
+	return found, nil
+}
+
+func (s *userStore) Credentials(ctx context.Context, userName string) (*User, []byte, error) {
+	row := s.db.QueryRowContext(ctx, `
+		select`+userColumns+`, u.password
+		from users u
+		where u.user_name = $1;
+	`, userName)
+
+	var password []byte
+
+	user, err := scanUser(row, &password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, password, nil
+}
+
+func (s *userStore) List(ctx context.Context, page Page) ([]*User, bool, error) {
+	return pageUsers(ctx, s.db, page, `
+		select`+userColumns+`
+		from users u
+		where `+usersAfter+usersNewestFirst+`;
+	`)
+}
+
+func (s *userStore) Count(ctx context.Context) (int, error) {
+	return count(ctx, s.db, `select count(*) from users;`)
+}
+
+func (s *userStore) Create(ctx context.Context, u NewUser) (*User, error) {
+	var userId string
+
+	err := s.db.QueryRowContext(ctx, `
+		insert into users (first_name, last_name, email, date_of_birth, is_active, phone, "password", user_name)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)
+		returning user_id;
+	`, u.FirstName, u.LastName, u.Email, u.DateOfBirth.Format("2006-01-02"), u.IsActive, u.Phone, string(u.Password), u.UserName).Scan(&userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ByID(ctx, userId)
+}
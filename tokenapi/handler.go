@@ -0,0 +1,329 @@
+// Package tokenapi lets admins issue, list and revoke long lived access tokens for streaming encoders,
+// bots and other services. Each token is limited to explicit scopes and an expiry, and every issued or
+// revoked token is recorded in the audit log.
+//
+//	POST   /tokens       issue a token, the secret is only ever returned in this response
+//	GET    /tokens       list the issued tokens
+//	DELETE /tokens/{id}  revoke a token
+package tokenapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/logging"
+	"github.com/gloompi/tantora-back/app/store"
+	"github.com/gloompi/tantora-back/app/utils"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Prefix is the path the handler is mounted on
+	Prefix = "/tokens"
+
+	maxLifetime    = 366 * 24 * time.Hour
+	maxLabelLength = 100
+	// bounds the size of an issue request
+	maxBodyBytes = 1 << 16
+
+	actionIssued  = "service_token.issued"
+	actionRevoked = "service_token.revoked"
+)
+
+var errMethodNotAllowed = apperr.New(apperr.MethodNotAllowed, "method not allowed")
+
+type Handler struct {
+	store *store.Store
+}
+
+func NewHandler(s *store.Store) *Handler {
+	return &Handler{store: s}
+}
+
+type issueRequest struct {
+	UserId    string   `json:"userId"`
+	Label     string   `json:"label"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expiresAt"`
+}
+
+type tokenResponse struct {
+	Id        string     `json:"id"`
+	UserId    string     `json:"userId"`
+	Label     string     `json:"label"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	CreatedBy string     `json:"createdBy,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	// Token is the secret, only set in the response to the request issuing it
+	Token string `json:"token,omitempty"`
+}
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code    apperr.Code       `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	ctx := req.Context()
+
+	identity, err := auth.FromContext(ctx)
+	if err != nil {
+		writeError(ctx, w, err)
+		return
+	}
+
+	// a scoped token must not be able to mint tokens, whatever its scopes
+	if !identity.HasAny(auth.RoleAdmin) || identity.Scopes != nil {
+		writeError(ctx, w, auth.ErrForbidden)
+		return
+	}
+
+	tokenId := strings.Trim(strings.TrimPrefix(req.URL.Path, Prefix), "/")
+
+	switch {
+	case tokenId == "" && req.Method == http.MethodGet:
+		h.list(ctx, w)
+	case tokenId == "" && req.Method == http.MethodPost:
+		h.issue(ctx, w, req, identity)
+	case tokenId != "" && req.Method == http.MethodDelete:
+		h.revoke(ctx, w, tokenId, identity)
+	case tokenId == "":
+		w.Header().Set("Allow", "GET, POST")
+		writeError(ctx, w, errMethodNotAllowed)
+	default:
+		w.Header().Set("Allow", "DELETE")
+		writeError(ctx, w, errMethodNotAllowed)
+	}
+}
+
+func (h *Handler) list(ctx context.Context, w http.ResponseWriter) {
+	tokens, err := h.store.Tokens.List(ctx)
+	if err != nil {
+		writeError(ctx, w, err)
+		return
+	}
+
+	res := []tokenResponse{}
+	for _, token := range tokens {
+		res = append(res, newTokenResponse(token))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tokens": res})
+}
+
+func (h *Handler) issue(ctx context.Context, w http.ResponseWriter, req *http.Request, identity *auth.Identity) {
+	var body issueRequest
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		writeError(ctx, w, apperr.Wrap(apperr.ValidationFailed, "the body must be a JSON object describing the token", err))
+		return
+	}
+
+	if body.UserId == "" {
+		body.UserId = identity.UserId
+	}
+
+	expiresAt, err := h.validate(ctx, &body)
+	if err != nil {
+		writeError(ctx, w, err)
+		return
+	}
+
+	// a token may act for another admin, the audit shows whose roles it carries
+	target, err := auth.Load(ctx, h.store.Roles, body.UserId)
+	if err != nil {
+		writeError(ctx, w, err)
+		return
+	}
+
+	td, err := utils.CreateScopedToken(body.UserId, body.Scopes, expiresAt)
+	if err != nil {
+		writeError(ctx, w, err)
+		return
+	}
+
+	if err := utils.CreateAuth(body.UserId, td); err != nil {
+		writeError(ctx, w, err)
+		return
+	}
+
+	token, err := h.store.Tokens.Create(ctx, store.NewServiceToken{
+		TokenId:   td.AccessUuid,
+		UserId:    body.UserId,
+		Label:     body.Label,
+		Scopes:    body.Scopes,
+		ExpiresAt: expiresAt,
+		CreatedBy: identity.UserId,
+	})
+	if err != nil {
+		// a token missing from the database could never be listed nor revoked
+		if _, delErr := utils.DeleteAuth(td.AccessUuid); delErr != nil {
+			logging.FromContext(ctx).WithError(delErr).Error("Failed to drop an unrecorded service token")
+		}
+		writeError(ctx, w, err)
+		return
+	}
+
+	h.audit(ctx, store.AuditEvent{
+		ActorId: identity.UserId,
+		Action:  actionIssued,
+		Target:  token.TokenId,
+		Details: map[string]interface{}{
+			"userId":    token.UserId,
+			"userRoles": target.Roles,
+			"label":     token.Label,
+			"scopes":    token.Scopes,
+			"expiresAt": token.ExpiresAt,
+		},
+	})
+
+	res := newTokenResponse(token)
+	res.Token = td.AccessToken
+
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// Check the issue request, the parsed expiry is returned
+func (h *Handler) validate(ctx context.Context, body *issueRequest) (time.Time, error) {
+	invalid := map[string]string{}
+
+	body.Label = strings.TrimSpace(body.Label)
+	if body.Label == "" {
+		invalid["label"] = "is required"
+	} else if len([]rune(body.Label)) > maxLabelLength {
+		invalid["label"] = "must be at most 100 characters"
+	}
+
+	if len(body.Scopes) == 0 {
+		invalid["scopes"] = "must list at least one scope"
+	}
+
+	seen := map[string]bool{}
+	for _, scope := range body.Scopes {
+		if !auth.ValidScope(scope) {
+			invalid["scopes"] = "unknown scope " + scope
+			break
+		}
+		if seen[scope] {
+			invalid["scopes"] = "lists " + scope + " more than once"
+			break
+		}
+		seen[scope] = true
+	}
+
+	now := time.Now()
+
+	expiresAt, err := time.Parse(time.RFC3339Nano, body.ExpiresAt)
+	switch {
+	case body.ExpiresAt == "":
+		invalid["expiresAt"] = "is required"
+	case err != nil:
+		invalid["expiresAt"] = "must be an RFC 3339 date time"
+	case !expiresAt.After(now):
+		invalid["expiresAt"] = "must be in the future"
+	case expiresAt.After(now.Add(maxLifetime)):
+		invalid["expiresAt"] = "must be at most a year away"
+	}
+
+	_, err = h.store.Users.ByID(ctx, body.UserId)
+	if err == store.ErrNotFound {
+		invalid["userId"] = "no such user"
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(invalid) > 0 {
+		return time.Time{}, apperr.Validation(invalid)
+	}
+
+	return expiresAt, nil
+}
+
+func (h *Handler) revoke(ctx context.Context, w http.ResponseWriter, tokenId string, identity *auth.Identity) {
+	token, err := h.store.Tokens.Revoke(ctx, tokenId)
+	if err != nil {
+		writeError(ctx, w, err)
+		return
+	}
+
+	if _, err := utils.DeleteAuth(token.TokenId); err != nil {
+		writeError(ctx, w, err)
+		return
+	}
+
+	h.audit(ctx, store.AuditEvent{
+		ActorId: identity.UserId,
+		Action:  actionRevoked,
+		Target:  token.TokenId,
+		Details: map[string]interface{}{"userId": token.UserId, "label": token.Label},
+	})
+
+	writeJSON(w, http.StatusOK, newTokenResponse(token))
+}
+
+// Record the event in the audit log and the request log, failing to store it doesn't undo the action
+func (h *Handler) audit(ctx context.Context, e store.AuditEvent) {
+	entry := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"audit_action": e.Action,
+		"audit_target": e.Target,
+		"actor_id":     e.ActorId,
+	})
+
+	if err := h.store.Audit.Record(ctx, e); err != nil {
+		entry.WithError(err).Error("Failed to record audit event")
+	}
+
+	entry.Info("Audited " + e.Action)
+}
+
+func newTokenResponse(token *store.ServiceToken) tokenResponse {
+	return tokenResponse{
+		Id:        token.TokenId,
+		UserId:    token.UserId,
+		Label:     token.Label,
+		Scopes:    token.Scopes,
+		ExpiresAt: token.ExpiresAt,
+		CreatedBy: token.CreatedBy,
+		CreatedAt: token.CreatedAt,
+		RevokedAt: token.RevokedAt,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, res interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
+
+// Answer with the error and the status matching its code
+func writeError(ctx context.Context, w http.ResponseWriter, err error) {
+	appErr := apperr.From(err)
+
+	entry := logging.FromContext(ctx).WithError(err).WithField("code", appErr.Code)
+	if appErr.Code == apperr.Internal {
+		entry.Error("Failed to handle token request")
+	} else {
+		entry.Debug("Rejected token request")
+	}
+
+	writeJSON(w, appErr.HTTPStatus(), errorResponse{errorBody{appErr.Code, appErr.Message, appErr.Fields}})
+}
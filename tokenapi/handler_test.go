@@ -0,0 +1,257 @@
+package tokenapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gloompi/tantora-back/app/apperr"
+	"github.com/gloompi/tantora-back/app/auth"
+	"github.com/gloompi/tantora-back/app/config"
+	"github.com/gloompi/tantora-back/app/store/storetest"
+	"github.com/gloompi/tantora-back/app/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fixture struct {
+	redis   *miniredis.Miniredis
+	fakes   *storetest.Fakes
+	handler *Handler
+	admin   *auth.Identity
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := utils.InitRedis(config.Redis{Address: m.Addr()}); err != nil {
+		t.Fatal(err)
+	}
+	utils.InitTokens(config.JWT{AccessSecret: "access", RefreshSecret: "refresh"}, nil)
+
+	fakes := storetest.New()
+	fakes.AddUser("1", "admin")
+	fakes.AddUser("2", "producer")
+	fakes.AddUser("3", "admin")
+
+	return &fixture{
+		redis:   m,
+		fakes:   fakes,
+		handler: NewHandler(fakes.Store()),
+		admin:   &auth.Identity{UserId: "1", Roles: []auth.Role{auth.RoleAdmin}},
+	}
+}
+
+// Send a request as the given caller, nil for an anonymous one
+func (f *fixture) do(identity *auth.Identity, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+
+	var err error
+	if identity == nil {
+		err = auth.ErrUnauthenticated
+	}
+	req = req.WithContext(auth.NewContext(req.Context(), identity, err))
+
+	rec := httptest.NewRecorder()
+	f.handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func validRequest() map[string]interface{} {
+	return map[string]interface{}{
+		"userId":    "2",
+		"label":     "encoder",
+		"scopes":    []string{"exhibitions:read"},
+		"expiresAt": time.Now().Add(30 * 24 * time.Hour).Format(time.RFC3339),
+	}
+}
+
+func errorOf(t *testing.T, rec *httptest.ResponseRecorder) errorBody {
+	t.Helper()
+
+	var res errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	return res.Error
+}
+
+func TestOnlyAdminSessionsManageTokens(t *testing.T) {
+	f := newFixture(t)
+	defer f.redis.Close()
+
+	callers := map[string]*auth.Identity{
+		"producer": {UserId: "2", Roles: []auth.Role{auth.RoleProducer}},
+		"admin through a scoped token": {
+			UserId: "1",
+			Roles:  []auth.Role{auth.RoleAdmin},
+			Scopes: []auth.Scope{auth.ScopeUsersRead, auth.ScopeExhibitionsWrite},
+		},
+	}
+
+	for name, identity := range callers {
+		t.Run(name, func(t *testing.T) {
+			for _, method := range []string{http.MethodGet, http.MethodPost} {
+				rec := f.do(identity, method, Prefix, validRequest())
+
+				if rec.Code != http.StatusForbidden {
+					t.Fatalf("%s got status %d, want 403", method, rec.Code)
+				}
+				if code := errorOf(t, rec).Code; code != apperr.Forbidden {
+					t.Fatalf("%s got code %s", method, code)
+				}
+			}
+		})
+	}
+
+	if rec := f.do(nil, http.MethodGet, Prefix, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("an anonymous caller got status %d, want 401", rec.Code)
+	}
+
+	if n := len(f.fakes.Audit.Events()); n != 0 {
+		t.Fatalf("%d audit events recorded for rejected requests", n)
+	}
+}
+
+func TestIssueValidation(t *testing.T) {
+	f := newFixture(t)
+	defer f.redis.Close()
+
+	tests := []struct {
+		name  string
+		field string
+		value interface{}
+	}{
+		{"unknown scope", "scopes", []string{"exhibitions:read", "everything"}},
+		{"duplicate scope", "scopes", []string{"exhibitions:read", "exhibitions:read"}},
+		{"no scopes", "scopes", []string{}},
+		{"no expiry", "expiresAt", ""},
+		{"past expiry", "expiresAt", time.Now().Add(-time.Minute).Format(time.RFC3339)},
+		{"expiry over a year away", "expiresAt", time.Now().Add(400 * 24 * time.Hour).Format(time.RFC3339)},
+		{"unknown user", "userId", "404"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := validRequest()
+			body[test.field] = test.value
+
+			rec := f.do(f.admin, http.MethodPost, Prefix, body)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("got status %d, want 400", rec.Code)
+			}
+
+			res := errorOf(t, rec)
+			if res.Code != apperr.ValidationFailed {
+				t.Fatalf("got code %s, want %s", res.Code, apperr.ValidationFailed)
+			}
+			if res.Fields[test.field] == "" {
+				t.Fatalf("no problem reported for %s: %v", test.field, res.Fields)
+			}
+		})
+	}
+
+	tokens, _ := f.fakes.Tokens.List(context.Background())
+	if len(tokens) != 0 {
+		t.Fatalf("%d tokens issued by invalid requests", len(tokens))
+	}
+}
+
+func TestIssueAndRevoke(t *testing.T) {
+	f := newFixture(t)
+	defer f.redis.Close()
+
+	rec := f.do(f.admin, http.MethodPost, Prefix, validRequest())
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want 201: %s", rec.Code, rec.Body.String())
+	}
+
+	var issued tokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&issued); err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := utils.ValidateToken(issued.Token)
+	if err != nil {
+		t.Fatalf("the issued token doesn't validate: %v", err)
+	}
+	if details.UserId != "2" || len(details.Scopes) != 1 || details.Scopes[0] != "exhibitions:read" {
+		t.Fatalf("the token carries user %s and scopes %v", details.UserId, details.Scopes)
+	}
+
+	rec = f.do(f.admin, http.MethodDelete, Prefix+"/"+issued.Id, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoking got status %d, want 200", rec.Code)
+	}
+
+	if _, err := utils.ValidateToken(issued.Token); err == nil {
+		t.Fatal("the revoked token still validates")
+	}
+
+	events := f.fakes.Audit.Events()
+	if len(events) != 2 {
+		t.Fatalf("%d audit events recorded, want 2", len(events))
+	}
+
+	for i, action := range []string{actionIssued, actionRevoked} {
+		if events[i].Action != action || events[i].ActorId != "1" || events[i].Target != issued.Id {
+			t.Fatalf("event %d is %+v", i, events[i])
+		}
+	}
+
+	roles, _ := events[0].Details["userRoles"].([]auth.Role)
+	if len(roles) != 1 || roles[0] != auth.RoleProducer {
+		t.Fatalf("the issue event records the roles %v", events[0].Details["userRoles"])
+	}
+}
+
+func TestIssueForAnotherAdminRecordsTheirRoles(t *testing.T) {
+	f := newFixture(t)
+	defer f.redis.Close()
+
+	body := validRequest()
+	body["userId"] = "3"
+
+	if rec := f.do(f.admin, http.MethodPost, Prefix, body); rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want 201", rec.Code)
+	}
+
+	roles, _ := f.fakes.Audit.Events()[0].Details["userRoles"].([]auth.Role)
+	if len(roles) != 1 || roles[0] != auth.RoleAdmin {
+		t.Fatalf("the issue event records the roles %v", roles)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	f := newFixture(t)
+	defer f.redis.Close()
+
+	for path, allow := range map[string]string{Prefix: "GET, POST", Prefix + "/some-id": "DELETE"} {
+		rec := f.do(f.admin, http.MethodPut, path, nil)
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("%s got status %d, want 405", path, rec.Code)
+		}
+		if rec.Header().Get("Allow") != allow {
+			t.Fatalf("%s allows %q, want %q", path, rec.Header().Get("Allow"), allow)
+		}
+		if code := errorOf(t, rec).Code; code != apperr.MethodNotAllowed {
+			t.Fatalf("%s got code %s", path, code)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package tracing sets up OpenTelemetry spans across the HTTP, GraphQL, gRPC and SQL layers, propagated
+// with W3C traceparent headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/gloompi/tantora-back/app/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+)
+
+const instrumentationName = "github.com/gloompi/tantora-back/app"
+
+// NewExporter builds the exporter spans are sent to
+type NewExporter func(conf config.Tracing) (sdktrace.SpanExporter, error)
+
+// Exporters holds the exporters selectable with tracing.exporter, "none" keeps tracing disabled.
+// Both dump spans as JSON in the stdouttrace format for debugging, it isn't OTLP and collectors can't
+// ingest it
+var Exporters = map[string]NewExporter{
+	"stdout": func(config.Tracing) (sdktrace.SpanExporter, error) {
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	},
+	// one JSON span per line appended to tracing.file
+	"debug-file": func(conf config.Tracing) (sdktrace.SpanExporter, error) {
+		f, err := os.OpenFile(conf.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(f))
+	},
+}
+
+var provider *sdktrace.TracerProvider
+
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Init installs the exporter chosen in the configuration, without it spans are created but dropped
+func Init(conf config.Tracing) error {
+	if conf.Exporter == "none" || conf.Exporter == "" {
+		return nil
+	}
+
+	newExporter, ok := Exporters[conf.Exporter]
+	if !ok {
+		return fmt.Errorf("unknown tracing exporter %q", conf.Exporter)
+	}
+
+	exporter, err := newExporter(conf)
+	if err != nil {
+		return err
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(conf.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return nil
+}
+
+// Shutdown flushes the spans still buffered
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+
+	return provider.Shutdown(ctx)
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// End finishes the span, marking it failed when err is set
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// StartRequest continues the trace of the caller given by the traceparent header
+func StartRequest(req *http.Request) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+	return Tracer().Start(ctx, req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPMethod(req.Method),
+			semconv.HTTPTarget(req.URL.Path),
+			semconv.HTTPUserAgent(req.UserAgent()),
+		),
+	)
+}
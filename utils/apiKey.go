@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// APIKeyPrefix starts every API key, it tells them apart from JWTs
+const APIKeyPrefix = "tnt_"
+
+// how much of a key is kept in clear to help users recognise it
+const apiKeyVisibleLength = len(APIKeyPrefix) + 8
+
+// GenerateAPIKey returns a new random key, the part of it that may be shown later and the hash to store
+func GenerateAPIKey() (key, visible, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	return key, key[:apiKeyVisibleLength], HashAPIKey(key), nil
+}
+
+// HashAPIKey hashes a key for storage and lookup, keys are random enough not to need a slow hash
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
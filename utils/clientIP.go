@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the networks whose X-Forwarded-For entries are believed
+var trustedProxies []*net.IPNet
+
+// InitTrustedProxies sets the networks of the proxies allowed to report the client address
+func InitTrustedProxies(networks []*net.IPNet) {
+	trustedProxies = networks
+}
+
+func trusted(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP is the address of the client. X-Forwarded-For is only read when the request comes from a
+// trusted proxy, and then from the right: the first hop that isn't a trusted proxy is the client
+func ClientIP(req *http.Request) string {
+	client, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		client = req.RemoteAddr
+	}
+
+	ip := net.ParseIP(client)
+	if ip == nil || !trusted(ip) {
+		return client
+	}
+
+	var hops []string
+	for _, header := range req.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// whatever lies further left wasn't written by a trusted proxy
+			return client
+		}
+
+		client = hop.String()
+		if !trusted(hop) {
+			return client
+		}
+	}
+
+	return client
+}
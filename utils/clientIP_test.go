@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"github.com/gloompi/tantora-back/app/config"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	networks, err := config.HTTP{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"}}.TrustedNetworks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	InitTrustedProxies(networks)
+	defer InitTrustedProxies(nil)
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct client", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"direct client forging the header", "203.0.113.7:4000", []string{"1.2.3.4"}, "203.0.113.7"},
+		{"behind a trusted proxy", "10.0.0.2:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"forged entry left of the client", "10.0.0.2:4000", []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"through two trusted proxies", "10.0.0.2:4000", []string{"203.0.113.7, 192.168.1.1"}, "203.0.113.7"},
+		{"repeated headers", "10.0.0.2:4000", []string{"1.2.3.4", "203.0.113.7"}, "203.0.113.7"},
+		{"garbage written by the client", "10.0.0.2:4000", []string{"not-an-ip"}, "10.0.0.2"},
+		{"trusted proxy without the header", "10.0.0.2:4000", nil, "10.0.0.2"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/graphql", nil)
+		req.RemoteAddr = test.remote
+		for _, value := range test.forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+
+		if got := ClientIP(req); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/gloompi/tantora-back/app/config"
+	"github.com/gloompi/tantora-back/app/jwks"
 	"github.com/twinj/uuid"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 )
@@ -16,6 +17,7 @@ type TokenDetails struct {
 	RefreshToken string
 	AccessUuid   string
 	RefreshUuid  string
+	SessionId    string
 	AtExpires    int64
 	RtExpires    int64
 }
@@ -23,10 +25,69 @@ type TokenDetails struct {
 type AccessDetails struct {
 	AccessUuid string
 	UserId     string
+	// SessionId is the login the token belongs to, empty for scoped tokens and tokens older than sessions
+	SessionId string
+	// Scopes limits what the token grants, nil for the tokens of a regular session
+	Scopes []string
 }
 
-func CreateToken(userId string) (*TokenDetails, error) {
-	td := &TokenDetails{}
+var accessSecret, refreshSecret []byte
+
+// signingKeys signs access tokens when it holds a key, refresh tokens are only ever read by this service
+// and stay signed with the refresh secret
+var signingKeys *jwks.Set
+
+func InitTokens(conf config.JWT, keys *jwks.Set) {
+	accessSecret = []byte(conf.AccessSecret)
+	refreshSecret = []byte(conf.RefreshSecret)
+	signingKeys = keys
+}
+
+// Sign access token claims with the signing key, naming it in the `kid` header
+func signAccessToken(claims jwt.MapClaims) (string, error) {
+	if signingKeys == nil || signingKeys.Signing() == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(accessSecret)
+	}
+
+	key := signingKeys.Signing()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+// Pick the key an access token is verified with, tokens signed with the access secret are accepted as
+// long as it's configured
+func accessKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(accessSecret) == 0 {
+			return nil, errors.New("tokens signed with a shared secret are no longer accepted")
+		}
+		return accessSecret, nil
+	}
+
+	if signingKeys == nil {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := signingKeys.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("key %q doesn't sign with %v", kid, token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+// CreateToken mints the access and refresh tokens of a session
+func CreateToken(userId, sessionId string) (*TokenDetails, error) {
+	td := &TokenDetails{SessionId: sessionId}
 	td.AtExpires = time.Now().Add(time.Minute * 15).Unix()
 	td.AccessUuid = uuid.NewV4().String()
 
@@ -39,10 +100,10 @@ func CreateToken(userId string) (*TokenDetails, error) {
 	atClaims["authorized"] = true
 	atClaims["access_uuid"] = td.AccessUuid
 	atClaims["user_id"] = userId
+	atClaims["session_id"] = sessionId
 	atClaims["exp"] = td.AtExpires
 
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	td.AccessToken, err = at.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
+	td.AccessToken, err = signAccessToken(atClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -50,10 +111,11 @@ func CreateToken(userId string) (*TokenDetails, error) {
 	rtClaims := jwt.MapClaims{}
 	rtClaims["refresh_uuid"] = td.RefreshUuid
 	rtClaims["user_id"] = userId
+	rtClaims["session_id"] = sessionId
 	rtClaims["exp"] = td.RtExpires
 
 	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	td.RefreshToken, err = rt.SignedString([]byte(os.Getenv("REFRESH_SECRET")))
+	td.RefreshToken, err = rt.SignedString(refreshSecret)
 	if err != nil {
 		return nil, err
 	}
@@ -61,9 +123,10 @@ func CreateToken(userId string) (*TokenDetails, error) {
 	return td, nil
 }
 
-func CreateLiveToken(userId string) (*TokenDetails, error) {
+// CreateScopedToken mints a long lived access token limited to the given scopes, it has no refresh token
+func CreateScopedToken(userId string, scopes []string, expires time.Time) (*TokenDetails, error) {
 	td := &TokenDetails{}
-	td.AtExpires = time.Now().Add(time.Hour * 24 * 31 * 12).Unix()
+	td.AtExpires = expires.Unix()
 	td.AccessUuid = uuid.NewV4().String()
 
 	var err error
@@ -72,10 +135,10 @@ func CreateLiveToken(userId string) (*TokenDetails, error) {
 	atClaims["authorized"] = true
 	atClaims["access_uuid"] = td.AccessUuid
 	atClaims["user_id"] = userId
+	atClaims["scopes"] = scopes
 	atClaims["exp"] = td.AtExpires
 
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	td.AccessToken, err = at.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
+	td.AccessToken, err = signAccessToken(atClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -92,6 +155,11 @@ func CreateAuth(userId string, td *TokenDetails) error {
 	if errAccess != nil {
 		return errAccess
 	}
+	// scoped tokens come without a refresh token
+	if td.RefreshUuid == "" {
+		return nil
+	}
+
 	errRefresh := client.Set(td.RefreshUuid, userId, rt.Sub(now)).Err()
 	if errRefresh != nil {
 		return errRefresh
@@ -122,6 +190,30 @@ func TokenValid(req *http.Request) (string, error) {
 	return tokenAuth.UserId, nil
 }
 
+func TokenValidString(token string) (string, error) {
+	tokenAuth, err := ValidateToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	return tokenAuth.UserId, nil
+}
+
+// ValidateToken checks the signature and expiry of an access token and that it wasn't revoked
+func ValidateToken(token string) (*AccessDetails, error) {
+	tokenAuth, err := ExtractTokenMetadataString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = FetchAuth(tokenAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenAuth, nil
+}
+
 func ExtractTokenMetadata(req *http.Request) (*AccessDetails, error) {
 	token, err := VerifyToken(req)
 	if err != nil {
@@ -130,23 +222,48 @@ func ExtractTokenMetadata(req *http.Request) (*AccessDetails, error) {
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if ok && token.Valid {
-		accessUuid, ok := claims["access_uuid"].(string)
-		if !ok {
-			return nil, errors.New("access uuid didn't found")
-		}
+		return accessDetails(claims)
+	}
+
+	return nil, err
+}
 
-		userId, ok := claims["user_id"].(string)
+func accessDetails(claims jwt.MapClaims) (*AccessDetails, error) {
+	accessUuid, ok := claims["access_uuid"].(string)
+	if !ok {
+		return nil, errors.New("access uuid didn't found")
+	}
+
+	userId, ok := claims["user_id"].(string)
+	if !ok {
+		return nil, errors.New("no user id provided")
+	}
+
+	sessionId, _ := claims["session_id"].(string)
+
+	details := &AccessDetails{
+		AccessUuid: accessUuid,
+		UserId:     userId,
+		SessionId:  sessionId,
+	}
+
+	if raw, ok := claims["scopes"]; ok {
+		list, ok := raw.([]interface{})
 		if !ok {
-			return nil, errors.New("no user id provided")
+			return nil, errors.New("malformed scopes")
 		}
 
-		return &AccessDetails{
-			AccessUuid: accessUuid,
-			UserId:     userId,
-		}, nil
+		details.Scopes = []string{}
+		for _, item := range list {
+			scope, ok := item.(string)
+			if !ok {
+				return nil, errors.New("malformed scopes")
+			}
+			details.Scopes = append(details.Scopes, scope)
+		}
 	}
 
-	return nil, err
+	return details, nil
 }
 
 func FetchAuth(authD *AccessDetails) (string, error) {
@@ -161,13 +278,7 @@ func FetchAuth(authD *AccessDetails) (string, error) {
 func VerifyToken(req *http.Request) (*jwt.Token, error) {
 	tokenString := ExtractToken(req)
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		//Make sure that the token method conform to "SigningMethodHMAC"
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("ACCESS_SECRET")), nil
-	})
+	token, err := jwt.Parse(tokenString, accessKey)
 
 	if err != nil {
 		return nil, err
@@ -188,13 +299,7 @@ func ExtractToken(req *http.Request) string {
 }
 
 func ExtractTokenMetadataString(token string) (*AccessDetails, error) {
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		//Make sure that the token method conform to "SigningMethodHMAC"
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("ACCESS_SECRET")), nil
-	})
+	parsedToken, err := jwt.Parse(token, accessKey)
 
 	if err != nil {
 		return nil, err
@@ -202,21 +307,17 @@ func ExtractTokenMetadataString(token string) (*AccessDetails, error) {
 
 	claims, ok := parsedToken.Claims.(jwt.MapClaims)
 	if ok && parsedToken.Valid {
-		accessUuid, ok := claims["access_uuid"].(string)
-		if !ok {
-			return nil, errors.New("access uuid didn't found")
-		}
-
-		userId, ok := claims["user_id"].(string)
-		if !ok {
-			return nil, errors.New("no user id provided")
-		}
-
-		return &AccessDetails{
-			AccessUuid: accessUuid,
-			UserId:     userId,
-		}, nil
+		return accessDetails(claims)
 	}
 
 	return nil, err
 }
+
+func ParseRefreshToken(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return refreshSecret, nil
+	})
+}
@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gloompi/tantora-back/app/config"
+	"github.com/gloompi/tantora-back/app/jwks"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testKeys struct {
+	dir string
+	// current signs, retired only verifies, stranger isn't part of the set
+	current, retired, stranger *jwks.Key
+	set                        *jwks.Set
+	// rsaPublicPEM is what an attacker would use as an HMAC secret
+	rsaPublicPEM []byte
+}
+
+// Write a private key and its public half as PEM files, named after name
+func writeKeyPair(t *testing.T, dir, name string, private crypto.Signer) (string, string, []byte) {
+	t.Helper()
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateFile := filepath.Join(dir, name+".pem")
+	publicFile := filepath.Join(dir, name+".pub")
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	if err := ioutil.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(publicFile, publicPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return privateFile, publicFile, publicPEM
+}
+
+// The signing key of a set loaded from a single private key file
+func signingKey(t *testing.T, file string) *jwks.Key {
+	t.Helper()
+
+	set, err := jwks.Load(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return set.Signing()
+}
+
+// An RSA signing key with a retired Ed25519 key, and an Ed25519 key the set doesn't know
+func generateKeys(t *testing.T) *testKeys {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, retiredKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, strangerKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	currentFile, _, rsaPublicPEM := writeKeyPair(t, dir, "current", rsaKey)
+	retiredFile, retiredPublicFile, _ := writeKeyPair(t, dir, "retired", retiredKey)
+	strangerFile, _, _ := writeKeyPair(t, dir, "stranger", strangerKey)
+
+	set, err := jwks.Load(currentFile, []string{retiredPublicFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testKeys{
+		dir:          dir,
+		current:      signingKey(t, currentFile),
+		retired:      signingKey(t, retiredFile),
+		stranger:     signingKey(t, strangerFile),
+		set:          set,
+		rsaPublicPEM: rsaPublicPEM,
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"access_uuid": "uuid",
+		"user_id":     "7",
+		"exp":         time.Now().Add(time.Minute).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestAccessKey(t *testing.T) {
+	keys := generateKeys(t)
+	defer os.RemoveAll(keys.dir)
+
+	withSecret := config.JWT{AccessSecret: "access", RefreshSecret: "refresh"}
+	withoutSecret := config.JWT{RefreshSecret: "refresh"}
+
+	tests := []struct {
+		name  string
+		conf  config.JWT
+		token string
+		valid bool
+	}{
+		{
+			name:  "signing key",
+			conf:  withoutSecret,
+			token: sign(t, keys.current.Method, keys.current.ID, keys.current.Private),
+			valid: true,
+		},
+		{
+			name:  "retired key",
+			conf:  withoutSecret,
+			token: sign(t, keys.retired.Method, keys.retired.ID, keys.retired.Private),
+			valid: true,
+		},
+		{
+			name:  "unknown kid",
+			conf:  withoutSecret,
+			token: sign(t, keys.stranger.Method, keys.stranger.ID, keys.stranger.Private),
+		},
+		{
+			name:  "no kid",
+			conf:  withoutSecret,
+			token: sign(t, keys.current.Method, "", keys.current.Private),
+		},
+		{
+			// the key would verify the signature, the key set only allows it to sign RS256
+			name:  "alg the key doesn't sign with",
+			conf:  withoutSecret,
+			token: sign(t, jwt.SigningMethodPS256, keys.current.ID, keys.current.Private),
+		},
+		{
+			name:  "public key as HMAC secret",
+			conf:  withoutSecret,
+			token: sign(t, jwt.SigningMethodHS256, keys.current.ID, keys.rsaPublicPEM),
+		},
+		{
+			name:  "public key as HMAC secret with a secret configured",
+			conf:  withSecret,
+			token: sign(t, jwt.SigningMethodHS256, keys.current.ID, keys.rsaPublicPEM),
+		},
+		{
+			name:  "none",
+			conf:  withSecret,
+			token: sign(t, jwt.SigningMethodNone, keys.current.ID, jwt.UnsafeAllowNoneSignatureType),
+		},
+		{
+			name:  "shared secret",
+			conf:  withSecret,
+			token: sign(t, jwt.SigningMethodHS256, "", []byte("access")),
+			valid: true,
+		},
+		{
+			name:  "shared secret no longer configured",
+			conf:  withoutSecret,
+			token: sign(t, jwt.SigningMethodHS256, "", []byte("access")),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			InitTokens(test.conf, keys.set)
+
+			_, err := jwt.Parse(test.token, accessKey)
+			if test.valid && err != nil {
+				t.Fatalf("rejected: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("accepted")
+			}
+		})
+	}
+}
+
+func TestCreateTokenSignsWithTheSigningKey(t *testing.T) {
+	keys := generateKeys(t)
+	defer os.RemoveAll(keys.dir)
+
+	InitTokens(config.JWT{RefreshSecret: "refresh"}, keys.set)
+
+	td, err := CreateToken("7", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.Parse(td.AccessToken, accessKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Method.Alg() != "RS256" || token.Header["kid"] != keys.current.ID {
+		t.Fatalf("signed with %v key %v, want RS256 key %s", token.Method.Alg(), token.Header["kid"], keys.current.ID)
+	}
+}
@@ -1,31 +1,40 @@
 package utils
 
 import (
+	"github.com/gloompi/tantora-back/app/config"
 	"github.com/go-redis/redis/v7"
-	"os"
+	"time"
 )
 
 var client *redis.Client
 
-func init() {
-	//Initializing redis
-	redisAddr := os.Getenv("REDIS_ADDRESS")
-	redisPass := os.Getenv("REDIS_PASSWORD")
-
-	if len(redisAddr) == 0 {
-		redisAddr = "0.0.0.0:6379"
-	}
-
-	if len(redisPass) == 0 {
-		redisPass = ""
-	}
-
+func InitRedis(conf config.Redis) error {
 	client = redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: redisPass,
+		Addr:     conf.Address,
+		Password: conf.Password,
 	})
+	client.AddHook(metricsHook{})
+
 	_, err := client.Ping().Result()
-	if err != nil {
-		panic(err)
-	}
+	return err
+}
+
+func Publish(channel string, message interface{}) error {
+	return client.Publish(channel, message).Err()
+}
+
+func Subscribe(channels ...string) *redis.PubSub {
+	return client.Subscribe(channels...)
+}
+
+func SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	return client.SetNX(key, value, expiration).Result()
+}
+
+func CloseRedis() error {
+	return client.Close()
+}
+
+func PingRedis() error {
+	return client.Ping().Err()
 }
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"github.com/go-redis/redis/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+var redisCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "redis_command_duration_seconds",
+	Help:    "Time taken by redis commands, pipelines are labelled as pipeline.",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+}, []string{"command", "status"})
+
+type startedKey struct{}
+
+// Time every command sent through the client
+type metricsHook struct{}
+
+func (metricsHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startedKey{}, time.Now()), nil
+}
+
+func (metricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	observeRedis(ctx, cmd.Name(), cmd.Err())
+	return nil
+}
+
+func (metricsHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startedKey{}, time.Now()), nil
+}
+
+func (metricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil {
+			err = cmd.Err()
+		}
+	}
+
+	observeRedis(ctx, "pipeline", err)
+	return nil
+}
+
+func observeRedis(ctx context.Context, command string, err error) {
+	started, ok := ctx.Value(startedKey{}).(time.Time)
+	if !ok {
+		return
+	}
+
+	// a missing key is an answer, not a failure
+	status := "ok"
+	if err != nil && err != redis.Nil {
+		status = "error"
+	}
+
+	redisCommandDuration.WithLabelValues(command, status).Observe(time.Since(started).Seconds())
+}
@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v7"
+	"github.com/twinj/uuid"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Every session is a hash under sessionPrefix+id, the ids of the sessions of a user are a set under
+// userSessionsPrefix+userId. Both expire with the refresh token of the newest session.
+// The refresh tokens of a session form a family: each one is traded for the next, and the ones traded
+// already are remembered under rotatedPrefix+refreshUuid until they would have expired.
+const (
+	sessionPrefix      = "session:"
+	userSessionsPrefix = "user_sessions:"
+	rotatedPrefix      = "rotated_refresh:"
+)
+
+var (
+	ErrSessionRevoked     = errors.New("the session was revoked or expired")
+	ErrRefreshTokenReused = errors.New("a refresh token that was rotated already was used again")
+)
+
+// Consume the refresh token KEYS[1] and remember it as rotated under KEYS[2] for ARGV[1] milliseconds.
+// Answers 1 once consumed, -1 when it was rotated before and 0 when it's unknown
+var rotateScript = redis.NewScript(`
+	if redis.call("del", KEYS[1]) == 1 then
+		redis.call("set", KEYS[2], "1", "px", ARGV[1])
+		return 1
+	end
+	if redis.call("exists", KEYS[2]) == 1 then
+		return -1
+	end
+	return 0
+`)
+
+// SessionMeta describes the client that opened a session, it's informational only
+type SessionMeta struct {
+	Device    string
+	UserAgent string
+	IP        string
+}
+
+// Session is one login of a user, it lives on through token refreshes until logout or revocation
+type Session struct {
+	SessionId   string
+	UserId      string
+	Device      string
+	UserAgent   string
+	IP          string
+	CreatedAt   time.Time
+	RefreshedAt time.Time
+
+	accessUuid  string
+	refreshUuid string
+}
+
+// StartSession mints the tokens of a new session and indexes the session under its user
+func StartSession(userId string, meta SessionMeta) (*TokenDetails, error) {
+	td, err := CreateToken(userId, uuid.NewV4().String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CreateAuth(userId, td); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	err = saveSession(&Session{
+		SessionId:   td.SessionId,
+		UserId:      userId,
+		Device:      meta.Device,
+		UserAgent:   meta.UserAgent,
+		IP:          meta.IP,
+		CreatedAt:   now,
+		RefreshedAt: now,
+	}, td)
+	if err != nil {
+		return nil, err
+	}
+
+	return td, nil
+}
+
+// RotateRefreshToken trades a refresh token of the session for new tokens. A refresh token presented
+// after it was traded has leaked, the whole session is then revoked and ErrRefreshTokenReused returned
+func RotateRefreshToken(userId, sessionId, refreshUuid string, expires time.Time) (*TokenDetails, error) {
+	ttl := time.Until(expires)
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+
+	status, err := rotateScript.Run(client, []string{refreshUuid, rotatedPrefix + refreshUuid}, ttl.Milliseconds()).Int()
+	if err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case 1:
+		td, err := RefreshSession(userId, sessionId)
+		if err != nil && err != ErrSessionRevoked {
+			// no tokens were handed out for the consumed one, give it back so the client can retry
+			if restoreErr := restoreRefreshToken(userId, refreshUuid, ttl); restoreErr != nil {
+				return nil, restoreErr
+			}
+		}
+		return td, err
+	case -1:
+		if _, err := RevokeSession(userId, sessionId); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	default:
+		return nil, ErrSessionRevoked
+	}
+}
+
+// Undo the rotation of a refresh token, it's valid again and no longer counts as rotated
+func restoreRefreshToken(userId, refreshUuid string, ttl time.Duration) error {
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(refreshUuid, userId, ttl)
+		pipe.Del(rotatedPrefix + refreshUuid)
+		return nil
+	})
+
+	return err
+}
+
+// RefreshSession mints new tokens for a session, the tokens issued before stop working
+func RefreshSession(userId, sessionId string) (*TokenDetails, error) {
+	session, err := loadSession(sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.UserId != userId {
+		return nil, ErrSessionRevoked
+	}
+
+	td, err := CreateToken(userId, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CreateAuth(userId, td); err != nil {
+		return nil, err
+	}
+
+	if err := client.Del(session.accessUuid, session.refreshUuid).Err(); err != nil {
+		return nil, err
+	}
+
+	session.RefreshedAt = time.Now()
+	if err := saveSession(session, td); err != nil {
+		return nil, err
+	}
+
+	return td, nil
+}
+
+func saveSession(s *Session, td *TokenDetails) error {
+	ttl := time.Until(time.Unix(td.RtExpires, 0))
+	key := sessionPrefix + s.SessionId
+	userKey := userSessionsPrefix + s.UserId
+
+	_, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(key, map[string]interface{}{
+			"user_id":      s.UserId,
+			"access_uuid":  td.AccessUuid,
+			"refresh_uuid": td.RefreshUuid,
+			"device":       s.Device,
+			"user_agent":   s.UserAgent,
+			"ip":           s.IP,
+			"created_at":   s.CreatedAt.Unix(),
+			"refreshed_at": s.RefreshedAt.Unix(),
+		})
+		pipe.Expire(key, ttl)
+		pipe.SAdd(userKey, s.SessionId)
+		// refresh tokens all live as long, the session saved last expires last
+		pipe.Expire(userKey, ttl)
+		return nil
+	})
+
+	return err
+}
+
+func loadSession(sessionId string) (*Session, error) {
+	fields, err := client.HGetAll(sessionPrefix + sessionId).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return nil, ErrSessionRevoked
+	}
+
+	return &Session{
+		SessionId:   sessionId,
+		UserId:      fields["user_id"],
+		Device:      fields["device"],
+		UserAgent:   fields["user_agent"],
+		IP:          fields["ip"],
+		CreatedAt:   unixField(fields["created_at"]),
+		RefreshedAt: unixField(fields["refreshed_at"]),
+		accessUuid:  fields["access_uuid"],
+		refreshUuid: fields["refresh_uuid"],
+	}, nil
+}
+
+func unixField(value string) time.Time {
+	seconds, _ := strconv.ParseInt(value, 10, 64)
+	return time.Unix(seconds, 0)
+}
+
+// Sessions lists the active sessions of a user, the most recently opened first
+func Sessions(userId string) ([]*Session, error) {
+	ids, err := client.SMembers(userSessionsPrefix + userId).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*Session{}
+	for _, id := range ids {
+		session, err := loadSession(id)
+		if err == ErrSessionRevoked {
+			// the session expired on its own, drop it from the index
+			client.SRem(userSessionsPrefix+userId, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession ends a session of the user, its access and refresh tokens stop working.
+// It reports whether the user had such a session
+func RevokeSession(userId, sessionId string) (bool, error) {
+	session, err := loadSession(sessionId)
+	if err == ErrSessionRevoked {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if session.UserId != userId {
+		return false, nil
+	}
+
+	_, err = client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(session.accessUuid, session.refreshUuid, sessionPrefix+sessionId)
+		pipe.SRem(userSessionsPrefix+userId, sessionId)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RevokeAllSessions ends every session of the user and returns how many there were
+func RevokeAllSessions(userId string) (int, error) {
+	ids, err := client.SMembers(userSessionsPrefix + userId).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, id := range ids {
+		ok, err := RevokeSession(userId, id)
+		if err != nil {
+			return revoked, err
+		}
+		if ok {
+			revoked++
+		}
+	}
+
+	return revoked, nil
+}
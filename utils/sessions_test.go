@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gloompi/tantora-back/app/config"
+	"github.com/go-redis/redis/v7"
+	"testing"
+	"time"
+)
+
+// Point the client at an in-memory redis and sign tokens with shared secrets
+func startRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client = redis.NewClient(&redis.Options{Addr: m.Addr()})
+	InitTokens(config.JWT{AccessSecret: "access", RefreshSecret: "refresh"}, nil)
+
+	return m
+}
+
+// failOnce fails the first command with the given name, as a dropped connection would
+type failOnce struct {
+	command string
+	failed  bool
+}
+
+func (f *failOnce) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if !f.failed && cmd.Name() == f.command {
+		f.failed = true
+		return ctx, errors.New("connection reset")
+	}
+	return ctx, nil
+}
+
+func (f *failOnce) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (f *failOnce) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (f *failOnce) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func rotate(td *TokenDetails) (*TokenDetails, error) {
+	return RotateRefreshToken("7", td.SessionId, td.RefreshUuid, time.Unix(td.RtExpires, 0))
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	m := startRedis(t)
+	defer m.Close()
+
+	td, err := StartSession("7", SessionMeta{Device: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := rotate(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rotated.SessionId != td.SessionId {
+		t.Fatalf("rotation moved the tokens to session %q", rotated.SessionId)
+	}
+
+	if _, err := ValidateToken(td.AccessToken); err == nil {
+		t.Fatal("the access token issued before the rotation still works")
+	}
+
+	if _, err := ValidateToken(rotated.AccessToken); err != nil {
+		t.Fatalf("the rotated access token doesn't work: %v", err)
+	}
+
+	// the next token of the family is traded in turn
+	if _, err := rotate(rotated); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotatedRefreshTokenReuseRevokesTheSession(t *testing.T) {
+	m := startRedis(t)
+	defer m.Close()
+
+	td, err := StartSession("7", SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := rotate(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rotate(td); err != ErrRefreshTokenReused {
+		t.Fatalf("got %v, want ErrRefreshTokenReused", err)
+	}
+
+	if _, err := ValidateToken(rotated.AccessToken); err == nil {
+		t.Fatal("the session still works after its refresh token was reused")
+	}
+
+	if _, err := rotate(rotated); err != ErrSessionRevoked {
+		t.Fatalf("got %v, want ErrSessionRevoked", err)
+	}
+
+	sessions, err := Sessions("7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("%d sessions left, want none", len(sessions))
+	}
+}
+
+func TestRotateUnknownRefreshToken(t *testing.T) {
+	m := startRedis(t)
+	defer m.Close()
+
+	td, err := StartSession("7", SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	td.RefreshUuid = "unknown"
+	if _, err := rotate(td); err != ErrSessionRevoked {
+		t.Fatalf("got %v, want ErrSessionRevoked", err)
+	}
+}
+
+func TestRotateIsRetryableAfterAFailedRefresh(t *testing.T) {
+	m := startRedis(t)
+	defer m.Close()
+
+	td, err := StartSession("7", SessionMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// loading the session fails right after the refresh token was consumed
+	client.AddHook(&failOnce{command: "hgetall"})
+
+	if _, err := rotate(td); err == nil || err == ErrRefreshTokenReused {
+		t.Fatalf("got %v, want the redis error", err)
+	}
+
+	rotated, err := rotate(td)
+	if err != nil {
+		t.Fatalf("the retry failed: %v", err)
+	}
+
+	if _, err := ValidateToken(rotated.AccessToken); err != nil {
+		t.Fatalf("the access token of the retry doesn't work: %v", err)
+	}
+}